@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+type fileConfig struct {
+	Shell          string   `toml:"shell"`
+	Pre            string   `toml:"pre"`
+	Prompt         string   `toml:"prompt"`
+	DefaultCommand string   `toml:"default-command"`
+	Debounce       duration `toml:"debounce"`
+	Timeout        duration `toml:"timeout"`
+	Manual         bool     `toml:"manual"`
+	Wrap           bool     `toml:"wrap"`
+	WrapWidth      int      `toml:"wrap-width"`
+	Mouse          bool     `toml:"mouse"`
+	FPS            int      `toml:"fps"`
+	LowPower       bool     `toml:"low-power"`
+	Split          bool     `toml:"split"`
+	RawBytes       bool     `toml:"raw-bytes"`
+	ScrollTop      bool     `toml:"scroll-top"`
+	LineNumbers    bool     `toml:"line-numbers"`
+	Timestamps     bool     `toml:"timestamps"`
+	Theme          string   `toml:"theme"`
+	StderrColor    string   `toml:"stderr-color"`
+	ColorMode      string   `toml:"color-mode"`
+	BufferSize     byteSize `toml:"buffer-size"`
+	MaxBuffer      byteSize `toml:"max-buffer"`
+	MaxLines       int      `toml:"max-lines"`
+
+	Keys    map[string][]string `toml:"keys"`
+	Colors  map[string]string   `toml:"colors"`
+	History struct {
+		SkipFailures bool `toml:"skip-failures"`
+	} `toml:"history"`
+}
+
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (s *byteSize) UnmarshalText(text []byte) error {
+	return s.Set(string(text))
+}
+
+func getConfigPath() string {
+	if path := os.Getenv("GOPLUMB_CONFIG"); path != "" {
+		return path
+	}
+
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "goplumb", "config.toml")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "goplumb", "config.toml")
+}
+
+func loadConfig(path string, c *fileConfig) error {
+	if path == "" {
+		return nil
+	}
+
+	md, err := toml.DecodeFile(path, c)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if keys := md.Undecoded(); len(keys) > 0 {
+		return fmt.Errorf("%s: unknown setting: %s", path, keys[0])
+	}
+	return nil
+}
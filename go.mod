@@ -3,9 +3,9 @@ module github.com/haccht/goplumb
 go 1.12
 
 require (
-	github.com/gdamore/tcell/v2 v2.1.0
-	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/BurntSushi/toml v0.4.1
+	github.com/creack/pty v1.1.18
+	github.com/gdamore/tcell/v2 v2.4.1-0.20210905002822-f057f0a857a1
 	github.com/mattn/go-isatty v0.0.12
-	github.com/rivo/tview v0.0.0-20210125085121-dbc1f32bb1d0
-	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0c // indirect
+	github.com/rivo/tview v0.0.0-20220916081518-2e69b7385a37
 )
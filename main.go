@@ -1,282 +1,375 @@
 package main
 
 import (
-	"bytes"
-	"context"
+	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/haccht/goplumb/plumb"
 	"github.com/mattn/go-isatty"
-	"github.com/rivo/tview"
 )
 
-const bufSize = 1024 * 16
-
-func getProgramName() string {
-	return filepath.Base(os.Args[0])
-}
+const (
+	maxBufSize = 16 << 20
+	maxFPS     = 240
+)
 
-type tui struct {
-	*tview.Application
-	layout *tview.Flex
-	footer *tview.Flex
+// Set with -ldflags "-X main.version=... -X main.commit=... -X main.date=...".
+var (
+	version = ""
+	commit  = "(devel)"
+	date    = "(devel)"
+)
 
-	MainView *tview.TextView
-	SizeView *tview.TextView
-	CmdInput *tview.InputField
+func printVersion() {
+	v := version
+	if v == "" {
+		v = "(devel)"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+	}
+	fmt.Printf("%s %s (commit %s, built %s)\n", filepath.Base(os.Args[0]), v, commit, date)
 }
 
-func newTUI() *tui {
-	ui := &tui{Application: tview.NewApplication()}
-
-	ui.MainView = tview.NewTextView()
-	ui.MainView.
-		SetDynamicColors(true).
-		SetBackgroundColor(tcell.Color235)
-
-	ui.SizeView = tview.NewTextView()
-	ui.SizeView.
-		SetText(fmt.Sprint("0 bytes")).
-		SetTextAlign(tview.AlignRight).
-		SetTextColor(tcell.ColorDarkGray).
-		SetBackgroundColor(tcell.ColorDefault)
-
-	ui.CmdInput = tview.NewInputField()
-	ui.CmdInput.
-		SetLabel(fmt.Sprintf("%s | ", getProgramName())).
-		SetLabelColor(tcell.ColorForestGreen).
-		SetPlaceholder("cat").
-		SetPlaceholderTextColor(tcell.ColorDarkGray).
-		SetFieldBackgroundColor(tcell.ColorDefault).
-		SetBackgroundColor(tcell.ColorDefault)
-
-	ui.footer = tview.NewFlex()
-	ui.footer.
-		AddItem(ui.CmdInput, 0, 1, true).
-		AddItem(ui.SizeView, 12, 0, false)
-
-	ui.layout = tview.NewFlex().SetDirection(tview.FlexRow)
-	ui.layout.
-		AddItem(ui.MainView, 0, 1, false).
-		AddItem(ui.footer, 1, 0, true)
-
-	ui.SetRoot(ui.layout, true)
-	return ui
+type byteSize int
+
+var byteUnits = map[string]int{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
 }
 
-func (ui *tui) GetInputText() string {
-	text := strings.TrimSpace(ui.CmdInput.GetText())
-	if text == "" {
-		text = "cat"
-	}
-	return text
+func (s *byteSize) String() string {
+	return strconv.Itoa(int(*s))
 }
 
-type history struct {
-	pos   int
-	Lines []string
-}
+func (s *byteSize) Set(value string) error {
+	value = strings.ToLower(strings.TrimSpace(value))
+	i := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(value)
+	}
 
-func (h *history) Prev() string {
-	if h.pos > 1 {
-		h.pos--
+	n, err := strconv.Atoi(value[:i])
+	if err != nil {
+		return fmt.Errorf("invalid size: %q", value)
 	}
-	return h.Lines[h.pos]
-}
 
-func (h *history) Next() string {
-	if h.pos < len(h.Lines)-1 {
-		h.pos++
+	unit, ok := byteUnits[strings.TrimSpace(value[i:])]
+	if !ok {
+		return fmt.Errorf("invalid size unit: %q", value)
 	}
-	return h.Lines[h.pos]
+
+	*s = byteSize(n * unit)
+	return nil
 }
 
-func (h *history) Append(line string) {
-	h.pos = len(h.Lines)
-	h.Lines = append(h.Lines, line)
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-type bufferedReader struct {
-	r   io.Reader
-	ch  chan []byte
-	buf *bytes.Buffer
-	ctx context.Context
-	err error
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
-func newBufferedReader(ctx context.Context, r io.Reader, buf *bytes.Buffer) *bufferedReader {
-	tr := io.TeeReader(r, buf)
-	mr := io.MultiReader(bytes.NewBuffer(buf.Bytes()), tr)
-	br := &bufferedReader{
-		r:   mr,
-		ch:  make(chan []byte),
-		buf: buf,
-		ctx: ctx,
-	}
-
-	go func() {
-		buf := make([]byte, bufSize)
-		for {
-			n, err := br.r.Read(buf)
-			if err != nil {
-				br.err = err
-				close(br.ch)
-				return
-			}
-
-			chunk := make([]byte, n)
-			copy(chunk, buf[:n])
-			br.ch <- chunk
-		}
-	}()
+type envList []string
+
+func (l *envList) String() string {
+	return strings.Join(*l, ",")
+}
 
-	return br
+func (l *envList) Set(value string) error {
+	if i := strings.IndexByte(value, '='); i <= 0 {
+		return fmt.Errorf("invalid environment variable: %q (must be KEY=VALUE)", value)
+	}
+	*l = append(*l, value)
+	return nil
 }
 
-func (br *bufferedReader) Buffer() *bytes.Buffer {
-	return br.buf
+// unescape interprets the escapes in a delimiter given on the command line,
+// e.g. \t or \x00.
+func unescape(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	u, err := strconv.Unquote(`"` + s + `"`)
+	if err == nil && u == "" {
+		err = fmt.Errorf("empty delimiter")
+	}
+	return u, err
 }
 
-func (br *bufferedReader) Read(p []byte) (int, error) {
-	select {
-	case <-br.ctx.Done():
-		return 0, br.ctx.Err()
-	case chunk, ok := <-br.ch:
-		if !ok {
-			return 0, br.err
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
-		copy(p, chunk)
-		return len(chunk), nil
 	}
+	return false
 }
 
-type App struct {
-	ui     *tui
-	hi     *history
-	bu     *bytes.Buffer
-	br     *bufferedReader
-	wc     io.WriteCloser
-	cancel context.CancelFunc
+// initialCommand returns the command given as arguments, or else the one in
+// $GOPLUMB_COMMAND, or else the contents of file.
+func initialCommand(args []string, file string) (string, error) {
+	if len(args) > 0 {
+		return strings.Join(args, " "), nil
+	}
+	if cmd := os.Getenv("GOPLUMB_COMMAND"); cmd != "" {
+		return cmd, nil
+	}
+	if file == "" {
+		return "", nil
+	}
+	b, err := ioutil.ReadFile(file)
+	return strings.TrimSpace(string(b)), err
 }
 
-func NewApp(command string) *App {
-	a := &App{
-		ui: newTUI(),
-		hi: &history{},
-		bu: bytes.NewBuffer(nil),
-		br: newBufferedReader(context.Background(), os.Stdin, bytes.NewBuffer(nil)),
-	}
-
-	a.ui.CmdInput.SetText(command)
-	a.ui.CmdInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		switch event.Key() {
-		case tcell.KeyEnter:
-			a.Stop()
-			a.Start()
-		case tcell.KeyCtrlC:
-			a.Stop()
-			a.ui.Stop()
-			fmt.Printf("%s-- \n", a.bu.String())
-			fmt.Printf("%s: %s\n", getProgramName(), a.ui.GetInputText())
-		case tcell.KeyUp, tcell.KeyCtrlP:
-			a.ui.CmdInput.SetText(a.hi.Prev())
-		case tcell.KeyDown, tcell.KeyCtrlN:
-			a.ui.CmdInput.SetText(a.hi.Next())
-		case tcell.KeyCtrlD:
-			return tcell.NewEventKey(tcell.KeyDelete, event.Rune(), event.Modifiers())
-		case tcell.KeyCtrlF:
-			return tcell.NewEventKey(tcell.KeyRight, event.Rune(), event.Modifiers())
-		case tcell.KeyCtrlB:
-			return tcell.NewEventKey(tcell.KeyLeft, event.Rune(), event.Modifiers())
+func openInput(files []string) (io.Reader, error) {
+	if len(files) == 0 {
+		if isatty.IsTerminal(os.Stdin.Fd()) {
+			return nil, fmt.Errorf("stdin not found")
 		}
-		return event
-	})
+		return os.Stdin, nil
+	}
 
-	return a
+	readers := make([]io.Reader, len(files))
+	for i, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		readers[i] = f
+	}
+	if len(readers) == 1 {
+		return readers[0], nil
+	}
+	return io.MultiReader(readers...), nil
 }
 
-func (a *App) Start() {
-	rc, wc := io.Pipe()
-	a.wc = wc
-
-	ctx, cancel := context.WithCancel(context.Background())
-	a.cancel = cancel
-
-	buf := a.br.Buffer()
-	a.br = newBufferedReader(ctx, os.Stdin, buf)
-	a.hi.Append(a.ui.GetInputText())
-	a.bu.Reset()
-
-	go func() {
-		b := make([]byte, bufSize)
-		t := tview.ANSIWriter(a.ui.MainView)
-
-		for {
-			n, err := rc.Read(b)
-			if n > 0 {
-				str := tview.Escape(string(b[0:n]))
-				t.Write([]byte(str))
-
-				a.bu.Write(b[0:n])
-				a.ui.SizeView.SetText(fmt.Sprintf("%6d bytes", a.bu.Len()))
-				a.ui.Draw()
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
+func main() {
+	fc := fileConfig{
+		Debounce:   duration(300 * time.Millisecond),
+		Wrap:       true,
+		Mouse:      true,
+		Theme:      "dark",
+		BufferSize: byteSize(16 << 10),
+		MaxBuffer:  byteSize(64 << 20),
+	}
+	if err := loadConfig(getConfigPath(), &fc); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	go func() {
-		cmd := a.createCmd(ctx)
-		cmd.Stdin = a.br
-		cmd.Stdout = a.wc
-		cmd.Stderr = a.wc
+	keys, err := plumb.NewKeymap(fc.Keys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-		cmd.Run()
-	}()
-}
+	cfg := plumb.Config{
+		Keys:           keys,
+		Shell:          fc.Shell,
+		Pre:            fc.Pre,
+		Prompt:         fc.Prompt,
+		DefaultCommand: fc.DefaultCommand,
+		Debounce:       time.Duration(fc.Debounce),
+		Timeout:        time.Duration(fc.Timeout),
+		Manual:         fc.Manual,
+		NoWrap:         !fc.Wrap,
+		WrapWidth:      fc.WrapWidth,
+		NoMouse:        !fc.Mouse,
+		FPS:            fc.FPS,
+		LowPower:       fc.LowPower,
+		Split:          fc.Split,
+		RawBytes:       fc.RawBytes,
+		ScrollTop:      fc.ScrollTop,
+		LineNumbers:    fc.LineNumbers,
+		Timestamps:     fc.Timestamps,
+		MaxLines:       fc.MaxLines,
+		StderrColor:    fc.StderrColor,
+		ColorMode:      fc.ColorMode,
+		SkipFailures:   fc.History.SkipFailures,
+	}
 
-func (a *App) Stop() {
-	a.wc.Close()
-	a.cancel()
+	var (
+		themeName   = fc.Theme
+		noColor     bool
+		forceColor  bool
+		stripANSI   bool
+		batch       bool
+		interactive bool
+		showVersion bool
+		recordDelim string
+		columnDelim string
+		commandFile string
+		bufSize     = fc.BufferSize
+		maxBuffer   = fc.MaxBuffer
+		inputFiles  stringList
+		env         envList
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [command]\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Var(&bufSize, "buffer-size", "size of the chunks read from input and output")
+	flag.IntVar(&cfg.MaxLines, "max-lines", cfg.MaxLines, "keep only the last `n` lines of output in the view (0 for unlimited)")
+	flag.Var(&maxBuffer, "max-buffer", "maximum size of input and output retained in memory (0 for unlimited)")
+	flag.StringVar(&cfg.OutputFile, "o", "", "write the final output to `file` on exit")
+	flag.StringVar(&cfg.OutputFile, "output", "", "write the final output to `file` on exit")
+	flag.BoolVar(&cfg.Force, "force", false, "overwrite the output file if it exists")
+	flag.BoolVar(&cfg.PrintCommand, "print-command", false, "print only the final command on exit")
+	flag.DurationVar(&cfg.Debounce, "debounce", cfg.Debounce, "re-run the command after typing pauses for `duration` (0 to disable)")
+	flag.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "kill the command when a run takes longer than `duration` (0 for no limit)")
+	flag.BoolVar(&cfg.Manual, "manual", cfg.Manual, "start in manual mode where only Enter runs the command")
+	flag.BoolVar(&cfg.NoMouse, "no-mouse", cfg.NoMouse, "disable mouse support")
+	flag.IntVar(&cfg.FPS, "fps", cfg.FPS, "draw new output at most `n` times a second (0 for the default of 30, or 5 with --low-power)")
+	flag.BoolVar(&cfg.LowPower, "low-power", cfg.LowPower, "draw less often and without the spinner to save battery")
+	flag.BoolVar(&cfg.NoWrap, "nowrap", cfg.NoWrap, "start with line wrapping disabled")
+	flag.IntVar(&cfg.WrapWidth, "wrap-width", cfg.WrapWidth, "wrap lines at column `n` instead of the screen width (0 for the screen width)")
+	flag.StringVar(&themeName, "theme", themeName, "color `theme` ("+strings.Join(plumb.ThemeNames(), " or ")+")")
+	flag.StringVar(&cfg.StderrColor, "stderr-color", cfg.StderrColor, "`color` used to render the command's stderr (defaults to the theme's)")
+	flag.StringVar(&cfg.ColorMode, "color-mode", cfg.ColorMode, "draw with `mode` colors ("+strings.Join(plumb.ColorModes, ", ")+"; default what the terminal supports)")
+	flag.BoolVar(&cfg.RawOutput, "raw-output", false, "omit the separator printed before the command on exit (default when stdout is not a terminal)")
+	flag.BoolVar(&cfg.RawBytes, "raw-bytes", cfg.RawBytes, "show exact byte counts instead of KiB, MiB and GiB")
+	flag.BoolVar(&cfg.Timestamps, "timestamps", cfg.Timestamps, "prefix each line with the time it arrived")
+	flag.BoolVar(&cfg.ExportTimestamps, "export-timestamps", false, "also add the timestamps to the output printed or saved on exit")
+	flag.StringVar(&columnDelim, "column-delimiter", "", "split columns at `delim` when aligning them with Alt-T (default tabs or spaces)")
+	flag.BoolVar(&cfg.EchoCommand, "echo-command", false, "show the command above its output, like a shell transcript")
+	flag.BoolVar(&cfg.LineNumbers, "line-numbers", cfg.LineNumbers, "number the lines of the output")
+	flag.BoolVar(&cfg.ScrollTop, "scroll-top", cfg.ScrollTop, "show the top of the output after every re-run")
+	flag.BoolVar(&cfg.Split, "split", cfg.Split, "show stderr in a separate pane below the output")
+	flag.BoolVar(&cfg.Follow, "follow", false, "re-run the command as new input arrives")
+	flag.BoolVar(&interactive, "interactive-stdin", false, "when stdin is a terminal, type the command's input into the editor with Alt-I")
+	flag.BoolVar(&batch, "batch", false, "run the command once and print its output without the editor")
+	flag.BoolVar(&noColor, "no-color", false, "disable colors and strip ANSI sequences from the command's output")
+	flag.BoolVar(&stripANSI, "strip-ansi", false, "strip ANSI sequences from the output printed, saved or committed on exit")
+	flag.BoolVar(&forceColor, "force-color", false, "keep ANSI sequences even when stdout is not a terminal or NO_COLOR is set")
+	flag.Var(&inputFiles, "f", "read input from `file` instead of stdin (repeatable)")
+	flag.Var(&inputFiles, "input", "read input from `file` instead of stdin (repeatable)")
+	flag.StringVar(&commandFile, "command-file", "", "start with the command in `file` when no command or $GOPLUMB_COMMAND is given")
+	flag.StringVar(&cfg.DefaultCommand, "default-command", cfg.DefaultCommand, "`command` run while the command line is empty (default cat)")
+	flag.BoolVar(&cfg.NoDefault, "no-default", false, "run nothing while the command line is empty instead of the default command")
+	flag.StringVar(&cfg.Prompt, "prompt", cfg.Prompt, "`text` shown before the command instead of the program name")
+	flag.StringVar(&cfg.Shell, "shell", cfg.Shell, "`shell` used to run the command, or none to run it without a shell")
+	flag.StringVar(&cfg.Pre, "pre", cfg.Pre, "`script` run by the shell before every command, e.g. 'set -o pipefail'")
+	flag.StringVar(&recordDelim, "record-delimiter", "", "run the command once per record of the input split at `delim`, e.g. '\\n' (slow)")
+	flag.BoolVar(&cfg.PTY, "pty", false, "run the command on a pseudo-terminal so it streams line-buffered output")
+	flag.Var(&env, "env", "set `KEY=VALUE` in the command's environment (repeatable)")
+	flag.StringVar(&cfg.WorkDir, "cwd", "", "run the command in `dir`")
+	flag.StringVar(&cfg.Commit, "commit", "", "pipe the output into `command` on exit instead of printing it")
+	flag.BoolVar(&cfg.ConfirmQuit, "confirm-quit", false, "ask before quitting")
+	flag.BoolVar(&showVersion, "version", false, "print the version and exit")
+	flag.Parse()
+
+	if showVersion {
+		printVersion()
+		return
+	}
 
-	a.ui.MainView.Clear()
-}
+	if cfg.RecordDelimiter, err = unescape(recordDelim); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid record delimiter: %q\n", recordDelim)
+		os.Exit(2)
+	}
+	if cfg.ColumnDelimiter, err = unescape(columnDelim); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid column delimiter: %q\n", columnDelim)
+		os.Exit(2)
+	}
 
-func (a *App) Run() error {
-	if isatty.IsTerminal(os.Stdin.Fd()) {
-		return fmt.Errorf("stdin not found")
+	if cfg.StderrColor != "" && tcell.GetColor(cfg.StderrColor) == tcell.ColorDefault {
+		fmt.Fprintf(os.Stderr, "invalid color: %q\n", cfg.StderrColor)
+		os.Exit(2)
 	}
 
-	a.Start()
-	return a.ui.Run()
-}
+	if cfg.ColorMode != "" && !contains(plumb.ColorModes, cfg.ColorMode) {
+		fmt.Fprintf(os.Stderr, "unknown color mode: %q (choose from %s)\n", cfg.ColorMode, strings.Join(plumb.ColorModes, ", "))
+		os.Exit(2)
+	}
 
-func (a *App) createCmd(ctx context.Context) *exec.Cmd {
-	shell := os.Getenv("SHELL")
-	if shell != "" {
-		return exec.CommandContext(ctx, shell, "-c", a.ui.GetInputText())
+	cfg.Theme, err = plumb.LookupTheme(themeName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for name, value := range fc.Colors {
+		if err := cfg.Theme.SetColor(name, value); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 	}
 
-	shell, _ = exec.LookPath("sh")
-	if shell != "" {
-		return exec.CommandContext(ctx, shell, "-c", a.ui.GetInputText())
+	// Zero leaves the rate to New, like an unset fps.
+	if cfg.FPS < 0 || cfg.FPS > maxFPS {
+		fmt.Fprintf(os.Stderr, "invalid fps: %d (must be between 1 and %d, or 0 for the default)\n", cfg.FPS, maxFPS)
+		os.Exit(2)
 	}
 
-	cmdArgs := strings.Fields(a.ui.GetInputText())
-	return exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
-}
+	if bufSize <= 0 || bufSize > maxBufSize {
+		fmt.Fprintf(os.Stderr, "invalid buffer size: %d (must be between 1 and %d)\n", bufSize, maxBufSize)
+		os.Exit(2)
+	}
 
-func main() {
-	app := NewApp(strings.Join(os.Args[1:], " "))
-	if err := app.Run(); err != nil {
+	cfg.NoColor = noColor || (os.Getenv("NO_COLOR") != "" && !forceColor)
+	cfg.PlainOutput = stripANSI || cfg.NoColor || (!isatty.IsTerminal(os.Stdout.Fd()) && !forceColor)
+	cfg.RawOutput = cfg.RawOutput || !isatty.IsTerminal(os.Stdout.Fd())
+
+	cfg.Env = env
+	cfg.Timestamps = cfg.Timestamps || cfg.ExportTimestamps
+	if cfg.Command, err = initialCommand(flag.Args(), commandFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cfg.BufferSize = int(bufSize)
+	cfg.MaxBuffer = int(maxBuffer)
+
+	if cfg.Debounce == 0 {
+		cfg.Debounce = -1
+	}
+
+	cfg.InteractiveInput = interactive && !batch && len(inputFiles) == 0 && isatty.IsTerminal(os.Stdin.Fd())
+	if !cfg.InteractiveInput {
+		r, err := openInput(inputFiles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.Input = r
+	}
+
+	app := plumb.New(cfg)
+	if batch {
+		status, err := app.Batch(os.Stdout, os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filepath.Base(os.Args[0]), err)
+			os.Exit(1)
+		}
+		os.Exit(status)
+	}
+
+	status, err := app.Run()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	os.Exit(status)
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildGoplumb builds the command into a temporary directory and returns the
+// path of the binary.
+func buildGoplumb(t *testing.T) string {
+	bin := filepath.Join(t.TempDir(), "goplumb")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return bin
+}
+
+type stage struct {
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+}
+
+// chain runs the commands with the stdout of each piped into the next, like
+// a shell pipeline fed with input, and returns the stdout of the last one.
+func chain(t *testing.T, input string, stages []*stage) string {
+	var stdout bytes.Buffer
+	var pipes []io.Closer
+	for i, s := range stages {
+		s.cmd.Stderr = &s.stderr
+		if i == 0 {
+			s.cmd.Stdin = strings.NewReader(input)
+		}
+		if i == len(stages)-1 {
+			s.cmd.Stdout = &stdout
+			continue
+		}
+		r, err := stages[i+1].cmd.StdinPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.cmd.Stdout = r
+		pipes = append(pipes, r)
+	}
+
+	for _, s := range stages {
+		if err := s.cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, s := range stages {
+		s.cmd.Wait()
+		if i < len(pipes) {
+			pipes[i].Close()
+		}
+	}
+	return stdout.String()
+}
+
+func TestBatchChain(t *testing.T) {
+	bin := buildGoplumb(t)
+	home := t.TempDir()
+	goplumb := func(args ...string) *stage {
+		cmd := exec.Command(bin, args...)
+		cmd.Env = append(os.Environ(), "HOME="+home, "XDG_CONFIG_HOME="+home, "GOPLUMB_HISTFILE="+filepath.Join(home, "history"))
+		return &stage{cmd: cmd}
+	}
+
+	tests := []struct {
+		name   string
+		input  string
+		stages []*stage
+		want   string
+		status []int
+		stderr []string
+	}{
+		{
+			name:   "two filters",
+			input:  "b\na\nb\n",
+			stages: []*stage{goplumb("--batch", "sort"), goplumb("--batch", "uniq")},
+			want:   "a\nb\n",
+			status: []int{0, 0},
+			stderr: []string{"", ""},
+		},
+		{
+			name:   "failing first",
+			input:  "x\ny\n",
+			stages: []*stage{goplumb("--batch", "cat; echo oops >&2; exit 3"), goplumb("--batch", "tr a-z A-Z")},
+			want:   "X\nY\n",
+			status: []int{3, 0},
+			stderr: []string{"oops\n", ""},
+		},
+		{
+			name:   "commented out",
+			input:  "b\na\n",
+			stages: []*stage{goplumb("--batch", "# sort"), goplumb("--batch", "tr a-z A-Z")},
+			want:   "B\nA\n",
+			status: []int{0, 0},
+			stderr: []string{"", ""},
+		},
+		{
+			name:   "with another filter",
+			input:  "1\n2\n3\n",
+			stages: []*stage{goplumb("--batch", "grep -v 2"), {cmd: exec.Command("sort", "-r")}, goplumb("--batch", "head -n 1; exit 1")},
+			want:   "3\n",
+			status: []int{0, 0, 1},
+			stderr: []string{"", "", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chain(t, tt.input, tt.stages); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+			for i, s := range tt.stages {
+				if got := s.cmd.ProcessState.ExitCode(); got != tt.status[i] {
+					t.Errorf("stage %d: status = %d, want %d", i, got, tt.status[i])
+				}
+				if got := s.stderr.String(); got != tt.stderr[i] {
+					t.Errorf("stage %d: stderr = %q, want %q", i, got, tt.stderr[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBatchStripANSI(t *testing.T) {
+	bin := buildGoplumb(t)
+	home := t.TempDir()
+	const command = `printf '\033[31mred\033[0m\n'`
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"strip-ansi", []string{"--strip-ansi"}, "red\n"},
+		{"piped", nil, "red\n"},
+		{"force-color", []string{"--force-color"}, "\x1b[31mred\x1b[0m\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(bin, append(append([]string{"--batch"}, tt.args...), command)...)
+			cmd.Env = append(os.Environ(), "HOME="+home, "XDG_CONFIG_HOME="+home, "NO_COLOR=")
+			cmd.Stdin = strings.NewReader("")
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("stdout = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
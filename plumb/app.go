@@ -0,0 +1,1624 @@
+// Package plumb implements goplumb's interactive pipeline editor.
+package plumb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	defaultFPS     = 30
+	lowPowerFPS    = 5
+	spinInterval   = time.Second / 10
+	noticeDuration = 2 * time.Second
+	drainTimeout   = time.Second
+)
+
+var spinFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// partialEscape matches the start of an ANSI sequence cut off at the end of
+// a write.
+var partialEscape = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*)?$`)
+
+const (
+	defaultBufferSize = 16 << 10
+	defaultDebounce   = 300 * time.Millisecond
+
+	statusTimeout   = -2
+	statusKilled    = -3
+	statusNoCommand = -4
+)
+
+// Config configures an App. Zero fields fall back to the defaults.
+type Config struct {
+	// Input is read by every run, stdin by default. A regular *os.File is
+	// read from disk on every run instead of being kept in memory.
+	Input io.Reader
+	// Screen, when set, is drawn on instead of the terminal, e.g. an
+	// initialized tcell.SimulationScreen to inject keys into in tests.
+	Screen tcell.Screen
+	// InteractiveInput replaces Input with the lines typed into the stdin
+	// prompt, shown with the stdin action, until Ctrl-D ends them.
+	InteractiveInput bool
+
+	Command string
+	// Prompt defaults to the program name.
+	Prompt string
+	// DefaultCommand runs while the command is empty, cat by default.
+	// NoDefault runs nothing instead.
+	DefaultCommand string
+	NoDefault      bool
+
+	HistoryFile string
+	// SkipFailures leaves a command out of the history until a run of it
+	// exits with status 0.
+	SkipFailures bool
+	SnippetsFile string
+	// Keys defaults to the default keys and Theme to the dark theme.
+	Keys  Keymap
+	Theme Theme
+
+	Shell string
+	// Pre is a script the shell runs before every command; it does not
+	// apply without a shell.
+	Pre string
+	// RecordDelimiter, when set, splits the input into records and runs the
+	// command once per record, concatenating the outputs.
+	RecordDelimiter string
+	// ColumnDelimiter splits the columns aligned by the table view instead
+	// of tabs or spaces.
+	ColumnDelimiter string
+	WorkDir         string
+	Env             []string
+	// PTY runs the command on a pseudo-terminal so that it flushes its
+	// output line by line; its stderr then shows up in the output.
+	PTY bool
+
+	// BufferSize is the size of the chunks read, 16KiB by default.
+	BufferSize int
+	// MaxBuffer bounds the input and output buffers, unlimited by default.
+	MaxBuffer int
+	// MaxLines keeps only the last lines of the output in the view while
+	// the buffer and the counts still cover all of it.
+	MaxLines int
+	// Debounce delays auto-run on typing, 300ms by default; a negative
+	// Debounce disables it.
+	Debounce time.Duration
+	// FPS bounds how many times a second new output is drawn, 30 by
+	// default.
+	FPS int
+	// Timeout kills the command when a run takes longer; zero means no
+	// limit.
+	Timeout time.Duration
+
+	Manual bool
+	NoWrap bool
+	// WrapWidth wraps the output at that column instead of the screen
+	// width.
+	WrapWidth int
+	NoMouse   bool
+	// LowPower draws 5 times a second unless FPS is set and replaces the
+	// spinner with a static "running".
+	LowPower bool
+	Split    bool
+	// StderrColor overrides the theme's color of stderr.
+	StderrColor string
+	// ColorMode limits the colors drawn to one of ColorModes, or forces
+	// 24-bit colors with "truecolor"; empty leaves them to the terminal.
+	ColorMode string
+
+	OutputFile string
+	// Commit runs a command on exit with the output as its stdin instead
+	// of printing the output, and its exit status becomes the App's.
+	Commit string
+	Force  bool
+	// ConfirmQuit asks before quitting.
+	ConfirmQuit  bool
+	PrintCommand bool
+	RawBytes     bool
+
+	// ScrollTop shows the top of the output after every re-run instead of
+	// restoring the scroll position once the new output is long enough.
+	ScrollTop bool
+	// LineNumbers starts with a gutter of line numbers in the view.
+	LineNumbers bool
+	// EchoCommand shows the command above its output in the view.
+	EchoCommand bool
+	// Timestamps prefixes each line in the view with the time it arrived,
+	// and ExportTimestamps also adds them to the output printed or saved
+	// on exit.
+	Timestamps       bool
+	ExportTimestamps bool
+	// Follow runs the command on the input read so far and re-runs it as
+	// more arrives.
+	Follow bool
+
+	// NoColor drops the theme and strips ANSI sequences from the command's
+	// output, and PlainOutput strips them from the output printed, saved
+	// or committed on exit.
+	NoColor     bool
+	PlainOutput bool
+	// RawOutput drops the "-- " separator printed before the final command
+	// line on stderr.
+	RawOutput bool
+}
+
+type scrollPos struct {
+	row, col, lines int
+}
+
+type App struct {
+	ui     *tui
+	hi     *history
+	sn     *snippets
+	cfg    Config
+	shell  string
+	bu     *ringBuffer
+	prev   *ringBuffer
+	bi     *inputBuffer
+	wc     io.WriteCloser
+	stdin  io.WriteCloser
+	we     io.WriteCloser
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	kill   context.CancelFunc
+	drains sync.WaitGroup
+
+	pending    bytes.Buffer
+	pendingErr bytes.Buffer
+	dirty      bool
+
+	running  bool
+	spin     int
+	silent   bool
+	viewing  bool
+	aborting bool
+
+	selecting bool
+	selLines  []string
+	selMark   int
+	selPos    int
+
+	sniffed     bool
+	dumper      io.WriteCloser
+	showBinary  bool
+	pretty      bool
+	table       bool
+	diff        bool
+	lineNumbers bool
+	stamps      []time.Time
+	stampBase   int
+	midLine     bool
+	errSpans    []span
+
+	// The output up to offset shown of bu, starting line shownLine, is in
+	// the view while its lines are formatted one by one, and drained counts
+	// the drains done.
+	shown     int
+	shownLine int
+	drained   int
+
+	keep   scrollPos
+	timer  *time.Timer
+	notice *time.Timer
+	err    error
+
+	autoRun bool
+	wrap    bool
+	split   bool
+	count   counter
+	metric  int
+	status  int
+
+	matchTag  string
+	findCase  bool
+	findPos   int
+	findCount int
+
+	filter       *regexp.Regexp
+	filterInvert bool
+
+	searchPos  int
+	searchText string
+
+	pickItems []pickItem
+	picked    []int
+
+	completion completion
+
+	unsaved   string
+	succeeded string
+	signal    syscall.Signal
+}
+
+// New returns an App configured by cfg.
+func New(cfg Config) *App {
+	var stdin io.WriteCloser
+	if cfg.InteractiveInput {
+		cfg.Input, stdin = io.Pipe()
+	} else if cfg.Input == nil {
+		cfg.Input = os.Stdin
+	}
+	if cfg.HistoryFile == "" {
+		cfg.HistoryFile = getHistoryPath()
+	}
+	if cfg.SnippetsFile == "" {
+		cfg.SnippetsFile = getSnippetsPath()
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	if cfg.Debounce == 0 {
+		cfg.Debounce = defaultDebounce
+	}
+	if cfg.FPS <= 0 {
+		cfg.FPS = defaultFPS
+		if cfg.LowPower {
+			cfg.FPS = lowPowerFPS
+		}
+	}
+	if cfg.NoColor {
+		cfg.Theme = Theme{}
+		cfg.StderrColor = "-"
+	} else if cfg.Theme == (Theme{}) {
+		cfg.Theme = themes["dark"]
+	}
+	if cfg.StderrColor == "" {
+		cfg.StderrColor = colorTag(cfg.Theme.Stderr)
+	}
+	if cfg.Keys == nil {
+		cfg.Keys, _ = NewKeymap(nil)
+	}
+	cfg.DefaultCommand = strings.TrimSpace(cfg.DefaultCommand)
+	if cfg.NoDefault {
+		cfg.DefaultCommand = ""
+	} else if cfg.DefaultCommand == "" {
+		cfg.DefaultCommand = "cat"
+	}
+	if cfg.Prompt == "" {
+		cfg.Prompt = getProgramName() + " | "
+	}
+
+	a := &App{
+		ui:    newTUI(cfg.Theme, cfg.Screen, cfg.Prompt, cfg.DefaultCommand),
+		hi:    newHistory(cfg.HistoryFile),
+		sn:    newSnippets(cfg.SnippetsFile),
+		cfg:   cfg,
+		stdin: stdin,
+		bu:    newRingBuffer(cfg.MaxBuffer),
+		prev:  newRingBuffer(cfg.MaxBuffer),
+		bi:    newInputBuffer(cfg.Input, cfg.MaxBuffer, cfg.BufferSize),
+	}
+
+	a.matchTag = fmt.Sprintf("[%s:%s]", colorTag(cfg.Theme.MatchFg), colorTag(cfg.Theme.MatchBg))
+	if cfg.NoColor || cfg.ColorMode == "mono" {
+		a.matchTag = "[::r]"
+	}
+
+	if cfg.MaxLines > 0 {
+		// One more for the empty line after the final newline.
+		a.ui.MainView.SetMaxLines(cfg.MaxLines + 1)
+		a.ui.ErrView.SetMaxLines(cfg.MaxLines + 1)
+	}
+	a.ui.CmdInput.SetText(cfg.Command)
+	a.SetAutoRun(!cfg.Manual)
+	a.SetWrap(!cfg.NoWrap)
+	a.SetSplit(cfg.Split)
+	a.lineNumbers = cfg.LineNumbers
+
+	a.ui.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Modifiers()&tcell.ModMeta != 0 && (event.Key() == tcell.KeyEnter || event.Key() == tcell.KeyTab) {
+			// A pasted line break or tab is typed as text.
+			if a.ui.GetFocus() == a.ui.CmdArea {
+				return tcell.NewEventKey(event.Key(), 0, tcell.ModNone)
+			}
+			event = tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone)
+		}
+
+		view := a.ui.MainView
+		if a.split && event.Modifiers()&tcell.ModAlt != 0 {
+			view = a.ui.ErrView
+		}
+
+		switch act := a.cfg.Keys.lookup(event); {
+		case a.ui.QuitVisible():
+			switch {
+			case act == actionQuit, act == actionAbort, event.Rune() == 'y', event.Rune() == 'Y':
+				if act != actionNone {
+					a.aborting = act == actionAbort
+				}
+				a.ui.HideQuit()
+				a.quit()
+			case event.Key() == tcell.KeyEscape, event.Key() == tcell.KeyEnter, event.Rune() == 'n', event.Rune() == 'N':
+				a.ui.HideQuit()
+			}
+			return nil
+		case act == actionQuit, act == actionAbort:
+			a.aborting = act == actionAbort
+			if a.cfg.ConfirmQuit {
+				a.ui.ShowQuit()
+				return nil
+			}
+			a.quit()
+			return nil
+		case a.ui.HelpVisible():
+			if act == actionHelp || event.Key() == tcell.KeyEscape {
+				a.ui.HideHelp()
+				return nil
+			}
+			return event
+		case a.ui.ExplainVisible():
+			if act == actionExplain || event.Key() == tcell.KeyEscape {
+				a.ui.HideExplain()
+				return nil
+			}
+			return event
+		case a.ui.ModalVisible():
+			return event
+		case act == actionHelp:
+			a.ui.ShowHelp(a.cfg.Keys.help())
+			return nil
+		case act == actionExplain:
+			a.ui.ShowExplain(a.explain())
+			return nil
+		case a.selecting:
+			return event
+		}
+
+		_, _, width, height := view.GetInnerRect()
+		switch event.Key() {
+		case tcell.KeyLeft, tcell.KeyRight:
+			if a.wrap || event.Modifiers()&tcell.ModShift == 0 {
+				return event
+			}
+			if event.Key() == tcell.KeyLeft {
+				width = -width
+			}
+			scrollColumns(view, width/2)
+		case tcell.KeyPgUp:
+			scroll(view, -height)
+		case tcell.KeyPgDn:
+			scroll(view, height)
+		case tcell.KeyHome:
+			view.ScrollToBeginning()
+		case tcell.KeyEnd:
+			view.ScrollToEnd()
+		default:
+			return event
+		}
+		return nil
+	})
+	a.ui.EnableMouse(!cfg.NoMouse)
+	a.ui.SetColorMode(cfg.ColorMode)
+	a.ui.SetMouseCapture(func(event *tcell.EventMouse, action tview.MouseAction) (*tcell.EventMouse, tview.MouseAction) {
+		switch action {
+		case tview.MouseScrollUp, tview.MouseScrollDown, tview.MouseMove:
+			return event, action
+		}
+
+		x, y := event.Position()
+		if a.ui.ModalVisible() || a.ui.GetFocus() == a.ui.Editor() && a.ui.InEditor(x, y) {
+			return event, action
+		}
+		return nil, action
+	})
+
+	a.ui.CmdInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch act := a.cfg.Keys.lookup(event); act {
+		case actionRun:
+			a.remember(a.ui.GetTypedText())
+			a.Restart()
+		case actionHistorySearch:
+			a.startSearch()
+		case actionHistoryPrev:
+			a.ui.CmdInput.SetText(a.hi.Prev(a.ui.CmdInput.GetText()))
+		case actionHistoryNext:
+			a.ui.CmdInput.SetText(a.hi.Next(a.ui.CmdInput.GetText()))
+		case actionDeleteChar:
+			return tcell.NewEventKey(tcell.KeyDelete, 0, tcell.ModNone)
+		case actionCursorRight:
+			return tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModNone)
+		case actionCursorLeft:
+			return tcell.NewEventKey(tcell.KeyLeft, 0, tcell.ModNone)
+		case actionComplete:
+			a.complete()
+		default:
+			if !a.handle(act) {
+				return event
+			}
+		}
+		return nil
+	})
+	a.ui.CmdArea.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEnter && event.Modifiers()&tcell.ModAlt != 0 {
+			a.remember(a.ui.GetTypedText())
+			a.Restart()
+			return nil
+		}
+		if !a.handle(a.cfg.Keys.lookup(event)) {
+			return event
+		}
+		return nil
+	})
+
+	a.ui.CmdInput.SetChangedFunc(func(text string) {
+		a.schedule()
+	})
+	a.ui.CmdArea.SetChangedFunc(func() {
+		a.schedule()
+	})
+
+	a.ui.SearchInput.SetChangedFunc(func(text string) {
+		a.searchPos = len(a.hi.Lines)
+		a.ui.CmdInput.SetText(a.searchText)
+		a.searchHistory()
+	})
+	a.ui.SearchInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			a.stopSearch(true)
+			return nil
+		case tcell.KeyEscape:
+			a.stopSearch(false)
+			return nil
+		case tcell.KeyCtrlR:
+			a.searchHistory()
+			return nil
+		}
+		return event
+	})
+
+	a.ui.StdinInput.SetInputCapture(a.handleStdin)
+
+	a.ui.NameInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			a.stopSaveSnippet(true)
+			return nil
+		case tcell.KeyEscape:
+			a.stopSaveSnippet(false)
+			return nil
+		}
+		return event
+	})
+
+	a.ui.SnippetList.SetDoneFunc(func() {
+		a.ui.HideModal("snippets")
+	})
+	a.ui.SnippetList.SetSelectedFunc(func(i int, name, command string, r rune) {
+		a.ui.HideModal("snippets")
+		a.setInputText(a.sn.Commands[a.sn.Names[i]])
+	})
+	a.ui.SnippetList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyDelete {
+			i := a.ui.SnippetList.GetCurrentItem()
+			if a.sn.Delete(a.sn.Names[i]) == nil {
+				a.ui.SnippetList.RemoveItem(i)
+			}
+			if len(a.sn.Names) == 0 {
+				a.ui.HideModal("snippets")
+			}
+			return nil
+		}
+		return event
+	})
+
+	a.ui.PickerInput.SetChangedFunc(func(text string) {
+		a.narrowPick()
+	})
+	a.ui.PickerInput.SetInputCapture(a.handlePick)
+
+	a.ui.FindInput.SetChangedFunc(func(text string) {
+		a.find()
+	})
+	a.ui.FindInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			a.stopFind(a.findCount > 0)
+			return nil
+		case tcell.KeyEscape:
+			a.stopFind(false)
+			return nil
+		case tcell.KeyCtrlT:
+			a.findCase = !a.findCase
+			a.find()
+			return nil
+		}
+		return event
+	})
+
+	a.ui.FilterInput.SetChangedFunc(func(text string) {
+		a.updateFilter()
+	})
+	a.ui.FilterInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			a.stopFilter(true)
+			return nil
+		case tcell.KeyEscape:
+			a.stopFilter(false)
+			return nil
+		case tcell.KeyCtrlV:
+			a.filterInvert = !a.filterInvert
+			a.updateFilter()
+			return nil
+		}
+		return event
+	})
+
+	a.ui.MainView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if a.selecting {
+			return a.handleSelect(event)
+		}
+		switch event.Key() {
+		case tcell.KeyEscape:
+			a.stopFind(false)
+			return nil
+		case tcell.KeyUp:
+			scroll(a.ui.MainView, -1)
+			return nil
+		case tcell.KeyDown:
+			scroll(a.ui.MainView, 1)
+			return nil
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'k':
+				scroll(a.ui.MainView, -1)
+				return nil
+			case 'j':
+				scroll(a.ui.MainView, 1)
+				return nil
+			case 'g':
+				a.ui.MainView.ScrollToBeginning()
+				return nil
+			case 'G':
+				a.ui.MainView.ScrollToEnd()
+				return nil
+			case 'n':
+				a.jumpFind(1)
+				return nil
+			case 'N':
+				a.jumpFind(-1)
+				return nil
+			case '/':
+				a.startFind()
+				return nil
+			}
+		}
+		if a.handle(a.cfg.Keys.lookup(event)) {
+			return nil
+		}
+		return event
+	})
+	// Blur is called while tview holds its lock, so the callbacks must not
+	// ask it for the focus.
+	a.ui.MainView.SetFocusFunc(func() {
+		a.viewing = true
+		a.updateMode()
+	})
+	a.ui.MainView.SetBlurFunc(func() {
+		a.viewing = false
+		a.updateMode()
+	})
+
+	return a
+}
+
+func (a *App) handle(act action) bool {
+	switch act {
+	case actionFind:
+		a.startFind()
+	case actionFilter:
+		a.startFilter()
+	case actionToggleAutoRun:
+		a.SetAutoRun(!a.autoRun)
+	case actionToggleWrap:
+		a.SetWrap(!a.wrap)
+	case actionToggleMultiline:
+		a.SetMultiline(!a.ui.multiline)
+	case actionCycleCount:
+		a.mu.Lock()
+		a.metric = (a.metric + 1) % 5
+		a.mu.Unlock()
+		a.updateSize()
+	case actionToggleSplit:
+		a.SetSplit(!a.split)
+		a.Restart()
+	case actionToggleBinary:
+		a.mu.Lock()
+		a.showBinary = !a.showBinary
+		a.mu.Unlock()
+		a.Restart()
+	case actionToggleLineNumbers:
+		a.lineNumbers = !a.lineNumbers
+		a.render()
+	case actionToggleJSON:
+		a.pretty = !a.pretty
+		a.render()
+		if _, ok := prettyJSON(a.bu.Bytes()); a.pretty && !ok {
+			a.notify("not JSON", a.cfg.Theme.Warning)
+		}
+	case actionToggleTable:
+		a.table = !a.table
+		a.render()
+	case actionToggleDiff:
+		a.diff = !a.diff
+		a.render()
+	case actionToggleFreeze:
+		if a.ui.Frozen() {
+			a.ui.Unfreeze()
+		} else {
+			a.flush()
+			a.ui.Freeze(a.ui.GetInputText(), a.ui.MainView.GetText(false))
+		}
+	case actionKill:
+		a.Kill()
+	case actionClear:
+		a.Clear()
+	case actionCopyCommand:
+		a.copy(a.ui.GetInputText())
+	case actionCopyOutput:
+		a.copy(ansiPattern.ReplaceAllString(string(a.exported()), ""))
+	case actionSelect:
+		a.startSelect()
+	case actionStdin:
+		a.startStdin()
+	case actionFocus:
+		if a.viewing {
+			a.stopFind(false)
+		} else {
+			a.ui.SetFocus(a.ui.MainView)
+		}
+	case actionPager:
+		a.page()
+	case actionSaveSnippet:
+		a.startSaveSnippet()
+	case actionPickSnippet:
+		a.pickSnippet()
+	case actionPickHistory:
+		a.startPick()
+	default:
+		return false
+	}
+	return true
+}
+
+func (a *App) startFind() {
+	a.ui.layout.RemoveItem(a.ui.FindInput)
+	a.ui.layout.AddItem(a.ui.FindInput, 1, 0, true)
+	a.ui.SetFocus(a.ui.FindInput)
+	a.find()
+}
+
+func (a *App) stopFind(keep bool) {
+	a.ui.layout.RemoveItem(a.ui.FindInput)
+	if keep {
+		a.ui.SetFocus(a.ui.MainView)
+		return
+	}
+
+	a.findCount = 0
+	a.ui.FindInput.SetText("")
+	a.ui.MainView.Highlight()
+	a.render()
+	a.ui.SetFocus(a.ui.Editor())
+}
+
+func (a *App) find() {
+	query := a.ui.FindInput.GetText()
+	pattern := regexp.QuoteMeta(query)
+	if !a.findCase {
+		pattern = "(?i)" + pattern
+	}
+
+	p, _ := a.visible()
+	text := ansiPattern.ReplaceAllString(sanitize(a.filterLines(p)), "")
+	locs := regexp.MustCompile(pattern).FindAllStringIndex(text, -1)
+	if query == "" {
+		locs = nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, loc := range locs {
+		b.WriteString(tview.Escape(text[last:loc[0]]))
+		fmt.Fprintf(&b, `["find-%d"]%s%s[-:-:-][""]`, i, a.matchTag, tview.Escape(text[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	b.WriteString(tview.Escape(text[last:]))
+
+	a.findPos = 0
+	a.findCount = len(locs)
+	a.discard(false)
+	a.ui.MainView.SetText(b.String())
+	a.jumpFind(0)
+}
+
+func (a *App) jumpFind(step int) {
+	label := "find: "
+	if a.findCase {
+		label = "find (Aa): "
+	}
+
+	if a.findCount == 0 {
+		a.ui.FindInput.SetLabel(label)
+		a.ui.MainView.Highlight()
+		return
+	}
+
+	a.findPos = (a.findPos + step + a.findCount) % a.findCount
+	a.ui.FindInput.SetLabel(fmt.Sprintf("%s[%d/%d] ", label, a.findPos+1, a.findCount))
+	a.ui.MainView.Highlight(fmt.Sprintf("find-%d", a.findPos)).ScrollToHighlight()
+}
+
+func (a *App) render() {
+	b, first, errs := a.snapshot()
+	a.ui.MainView.Clear()
+	io.WriteString(a.ui.MainView, a.echo())
+	if a.diff {
+		a.mu.Lock()
+		text := a.colorDiff(a.prev.Bytes(), a.bu.Bytes())
+		a.mu.Unlock()
+		io.WriteString(a.ui.MainView, text)
+		return
+	}
+	if a.pretty {
+		if p, ok := prettyJSON(a.bu.Bytes()); ok {
+			io.WriteString(a.ui.MainView, a.formatLines(p, 1, nil, nil, a.colorJSON))
+			return
+		}
+	}
+	p, first := a.lastLines(b, first)
+	errs = clipSpans(errs, len(b)-len(p), len(p))
+	if a.table {
+		// Aligning moves the bytes, so the stderr ranges no longer apply.
+		p = alignColumns(p, a.cfg.ColumnDelimiter)
+		errs = nil
+	}
+	w := tview.ANSIWriter(a.ui.MainView)
+	io.WriteString(w, a.formatLines(p, first, a.lineStamps(first, countLines(p)+1), errs, a.display))
+}
+
+// echo returns the command shown above its output with EchoCommand, like in
+// a shell transcript, or "".
+func (a *App) echo() string {
+	text := a.ui.GetInputText()
+	if !a.cfg.EchoCommand || text == "" {
+		return ""
+	}
+	text = strings.Replace(tview.Escape(text), "\n", "\n> ", -1)
+	return fmt.Sprintf("[%s]$ %s[-]\n", colorTag(a.cfg.Theme.Status), text)
+}
+
+func (a *App) setInputText(text string) {
+	if a.ui.multiline {
+		a.ui.CmdArea.SetText(text, true)
+		return
+	}
+	a.ui.CmdInput.SetText(text)
+}
+
+func (a *App) startSaveSnippet() {
+	a.ui.NameInput.SetText("")
+	a.ui.layout.AddItem(a.ui.NameInput, 1, 0, true)
+	a.ui.SetFocus(a.ui.NameInput)
+}
+
+func (a *App) stopSaveSnippet(save bool) {
+	a.ui.layout.RemoveItem(a.ui.NameInput)
+	a.ui.SetFocus(a.ui.Editor())
+
+	name := strings.TrimSpace(a.ui.NameInput.GetText())
+	if !save || name == "" {
+		return
+	}
+
+	if err := a.sn.Set(name, a.ui.GetInputText()); err != nil {
+		a.notify("save failed", a.cfg.Theme.Failure)
+		return
+	}
+	a.notify("saved", a.cfg.Theme.Success)
+}
+
+func (a *App) pickSnippet() {
+	if len(a.sn.Names) == 0 {
+		a.notify("no snippets", a.cfg.Theme.Status)
+		return
+	}
+
+	a.ui.SnippetList.Clear()
+	for _, name := range a.sn.Names {
+		a.ui.SnippetList.AddItem(tview.Escape(name), tview.Escape(a.sn.Commands[name]), 0, nil)
+	}
+	a.ui.ShowModal("snippets", a.ui.SnippetList, 72, 20)
+}
+
+// output returns the buffered output and the number of its first line,
+// counting the lines already dropped from the buffer.
+func (a *App) output() ([]byte, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	b := a.bu.Bytes()
+	return b, a.count.Lines - bytes.Count(b, []byte("\n")) + 1
+}
+
+// visible returns the part of the output shown in the view and the number of
+// its first line.
+func (a *App) visible() ([]byte, int) {
+	return a.lastLines(a.output())
+}
+
+// lastLines returns the last MaxLines lines of b, whose first line is first,
+// and the number of the first of them.
+func (a *App) lastLines(b []byte, first int) ([]byte, int) {
+	if a.cfg.MaxLines <= 0 {
+		return b, first
+	}
+
+	n := 0
+	for i := len(bytes.TrimSuffix(b, []byte("\n"))) - 1; i >= 0; i-- {
+		if b[i] == '\n' {
+			n++
+			if n == a.cfg.MaxLines {
+				return b[i+1:], first + bytes.Count(b[:i+1], []byte("\n"))
+			}
+		}
+	}
+	return b, first
+}
+
+func (a *App) startSearch() {
+	a.searchPos = len(a.hi.Lines)
+	a.searchText = a.ui.CmdInput.GetText()
+
+	a.ui.SearchInput.SetText("")
+	a.ui.layout.AddItem(a.ui.SearchInput, 1, 0, true)
+	a.ui.SetFocus(a.ui.SearchInput)
+}
+
+func (a *App) stopSearch(accept bool) {
+	if accept && a.searchPos < len(a.hi.Lines) {
+		a.hi.pos = a.searchPos
+	} else {
+		a.ui.CmdInput.SetText(a.searchText)
+	}
+
+	a.ui.layout.RemoveItem(a.ui.SearchInput)
+	a.ui.SetFocus(a.ui.Editor())
+}
+
+func (a *App) searchHistory() {
+	query := a.ui.SearchInput.GetText()
+	if query == "" {
+		return
+	}
+
+	if i := a.hi.Search(query, a.searchPos); i >= 0 {
+		a.searchPos = i
+		a.ui.CmdInput.SetText(a.hi.Lines[i])
+	}
+}
+
+func scroll(view *tview.TextView, lines int) {
+	row, col := view.GetScrollOffset()
+	if row += lines; row < 0 {
+		row = 0
+	}
+	view.ScrollTo(row, col)
+}
+
+func scrollColumns(view *tview.TextView, cols int) {
+	row, col := view.GetScrollOffset()
+	if col += cols; col < 0 {
+		col = 0
+	}
+	view.ScrollTo(row, col)
+}
+
+func (a *App) SetAutoRun(enable bool) {
+	a.autoRun = enable
+	if !enable && a.timer != nil {
+		a.timer.Stop()
+	}
+	a.updateMode()
+}
+
+func (a *App) SetSplit(enable bool) {
+	a.mu.Lock()
+	a.split = enable
+	a.mu.Unlock()
+	a.ui.SetSplit(enable)
+}
+
+func (a *App) SetMultiline(enable bool) {
+	if enable {
+		a.ui.CmdArea.SetText(a.ui.CmdInput.GetText(), true)
+	} else {
+		a.ui.CmdInput.SetText(joinLines(a.ui.CmdArea.GetText()))
+	}
+	a.ui.SetMultiline(enable)
+	a.ui.SetFocus(a.ui.Editor())
+}
+
+func (a *App) SetWrap(enable bool) {
+	a.wrap = enable
+	a.ui.MainView.SetWrap(enable)
+	if enable {
+		a.ui.SetWrapWidth(a.cfg.WrapWidth)
+	} else {
+		a.ui.SetWrapWidth(0)
+	}
+	a.updateMode()
+}
+
+func (a *App) updateMode() {
+	a.ui.CmdInput.SetLabelColor(a.cfg.Theme.Label)
+	if a.viewing {
+		a.ui.CmdInput.SetLabelColor(a.cfg.Theme.Status)
+	}
+
+	switch {
+	case a.selecting:
+		from, to := a.selRange()
+		a.ui.ModeView.SetText(fmt.Sprintf("%d selected", to-from)).SetTextColor(a.cfg.Theme.Label)
+		return
+	case a.viewing:
+		a.ui.ModeView.SetText("output").SetTextColor(a.cfg.Theme.Label)
+		return
+	}
+
+	var modes []string
+	if a.autoRun {
+		modes = append(modes, "auto")
+	} else {
+		modes = append(modes, "manual")
+	}
+
+	if a.wrap {
+		modes = append(modes, "wrap")
+	} else {
+		modes = append(modes, "nowrap")
+	}
+
+	a.ui.ModeView.SetText(strings.Join(modes, " ")).SetTextColor(a.cfg.Theme.Status)
+}
+
+func (a *App) notify(msg string, color tcell.Color) {
+	if a.notice != nil {
+		a.notice.Stop()
+	}
+
+	a.ui.ModeView.SetText(msg).SetTextColor(color)
+	a.notice = time.AfterFunc(noticeDuration, func() {
+		a.ui.QueueUpdateDraw(a.updateMode)
+	})
+}
+
+func (a *App) copy(text string) {
+	if err := copyToClipboard(text); err != nil {
+		a.notify("copy failed", a.cfg.Theme.Failure)
+		return
+	}
+	a.notify("copied", a.cfg.Theme.Success)
+}
+
+// page suspends the editor while the output is shown in the pager.
+func (a *App) page() {
+	out := a.exported()
+	if a.cfg.NoColor {
+		out = ansiPattern.ReplaceAll(out, nil)
+	}
+
+	var err error
+	a.ui.Suspend(func() {
+		err = runPager(out)
+	})
+	if err != nil {
+		a.notify("pager failed", a.cfg.Theme.Failure)
+	}
+}
+
+func (a *App) schedule() {
+	if !a.autoRun || a.cfg.Debounce <= 0 {
+		return
+	}
+
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.timer = time.AfterFunc(a.cfg.Debounce, func() {
+		a.ui.QueueUpdateDraw(a.Restart)
+	})
+}
+
+func (a *App) Restart() {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+
+	if !a.cfg.ScrollTop {
+		row, col := a.ui.MainView.GetScrollOffset()
+		a.mu.Lock()
+		a.keep = scrollPos{row: row, col: col, lines: a.count.Lines}
+		a.mu.Unlock()
+	}
+
+	if a.selecting {
+		a.stopSelect()
+	}
+	a.Stop()
+	a.Start()
+}
+
+func (a *App) quit() {
+	if a.ui.GetFocus() == a.ui.SearchInput {
+		a.stopSearch(false)
+	}
+	a.Quit()
+}
+
+func (a *App) Quit() {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+
+	// Stopping a running command leaves a.status at the last run that
+	// finished, so quitting mid-run is not reported as a kill.
+	a.settle()
+	a.Stop()
+	a.ui.Stop()
+	a.remember(a.ui.GetTypedText())
+	if a.aborting {
+		return
+	}
+
+	out := a.exported()
+	if a.selecting {
+		out = []byte(a.selected())
+	}
+	if a.cfg.PlainOutput {
+		out = ansiPattern.ReplaceAll(out, nil)
+	}
+
+	if a.cfg.OutputFile != "" {
+		a.err = ioutil.WriteFile(a.cfg.OutputFile, out, 0644)
+	}
+
+	if a.cfg.Commit != "" {
+		a.commit(out)
+	}
+
+	if a.cfg.PrintCommand {
+		fmt.Println(a.ui.GetInputText())
+		return
+	}
+
+	if a.cfg.OutputFile == "" && a.cfg.Commit == "" {
+		os.Stdout.Write(out)
+		if !a.cfg.RawOutput {
+			fmt.Fprint(os.Stderr, "-- \n")
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", getProgramName(), a.ui.GetInputText())
+}
+
+// remember appends text to the history, or with SkipFailures waits
+// until a run of it succeeds.
+func (a *App) remember(text string) {
+	if !a.cfg.SkipFailures || text == a.succeeded {
+		a.hi.Append(text)
+		return
+	}
+	a.unsaved = text
+}
+
+func (a *App) succeed(text string) {
+	a.succeeded = text
+	if a.unsaved == text {
+		a.hi.Append(text)
+		a.unsaved = ""
+	}
+}
+
+// settle kills the running command and gives the output it has already
+// written a moment to be drained, so that none of it is lost on exit.
+func (a *App) settle() {
+	a.kill()
+
+	done := make(chan struct{})
+	go func() {
+		a.drains.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+	}
+}
+
+// commit runs the Commit command on out and keeps its exit status.
+func (a *App) commit(out []byte) {
+	cmd, err := a.createCmd(context.Background(), a.cfg.Commit)
+	if err == nil {
+		cmd.Stdin = bytes.NewReader(out)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	}
+
+	a.status = exitStatus(err)
+	if a.status < 0 {
+		a.err = fmt.Errorf("%s", errorMessage(err))
+	} else if a.status > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %s: exit %d\n", getProgramName(), a.cfg.Commit, a.status)
+	}
+}
+
+func (a *App) Start() {
+	rc, wc := io.Pipe()
+	a.wc = wc
+
+	re, we := io.Pipe()
+	a.we = we
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+
+	runCtx, runCancel := context.WithCancel(ctx)
+	if a.cfg.Timeout > 0 {
+		runCtx, runCancel = context.WithTimeout(ctx, a.cfg.Timeout)
+	}
+	a.kill = runCancel
+
+	stdin := &countReader{Reader: a.bi.NewReader(runCtx)}
+	if a.cfg.Follow {
+		stdin.Reader = a.bi.Snapshot()
+	}
+
+	a.mu.Lock()
+	// Keep the output of the previous run to diff against.
+	a.prev, a.bu = a.bu, a.prev
+	a.resetOutput()
+	a.drained = 0
+	a.sniffed = false
+	a.dumper = nil
+	a.mu.Unlock()
+	a.updateSize()
+	a.setRunning(true)
+	a.ui.TimeView.SetText("")
+	io.WriteString(a.ui.MainView, a.echo())
+
+	if a.ui.GetInputText() == "" {
+		runCancel()
+		a.setStatus(statusNoCommand)
+		return
+	}
+
+	text := a.ui.GetTypedText()
+	var out io.ReadCloser = rc
+	var run func() error
+	if a.commentedOut() {
+		run = func() error {
+			_, err := io.Copy(wc, stdin)
+			return err
+		}
+	} else if a.cfg.RecordDelimiter != "" {
+		// Read the command here, as the editor may change it mid-run.
+		command := a.ui.GetInputText()
+		run = func() error {
+			return a.runRecords(runCtx, command, stdin, wc, we)
+		}
+	} else {
+		cmd, err := a.createCmd(runCtx, a.ui.GetInputText())
+		if err != nil {
+			runCancel()
+			a.fail(err)
+			return
+		}
+		cmd.Stdin = stdin
+		cmd.Stdout = wc
+		cmd.Stderr = we
+
+		var tty *os.File
+		if a.cfg.PTY {
+			_, _, width, height := a.ui.MainView.GetInnerRect()
+			ptmx, t, err := openPTY(cmd, width, height)
+			if err != nil {
+				runCancel()
+				a.fail(err)
+				return
+			}
+			out, tty = ptmx, t
+			a.wc = ptmx
+		}
+
+		run = func() error {
+			err := cmd.Start()
+			if tty != nil {
+				tty.Close()
+			}
+			if err == nil {
+				err = cmd.Wait()
+			}
+			return err
+		}
+	}
+
+	a.drains.Add(2)
+	go a.drain(out, tview.ANSIWriter(&a.pending), false)
+	go a.drain(re, tview.ANSIWriter(&a.pendingErr), true)
+
+	go func() {
+		started := time.Now()
+		err := run()
+		elapsed := time.Since(started)
+		timedOut := runCtx.Err() == context.DeadlineExceeded
+		killed := runCtx.Err() == context.Canceled
+		runCancel()
+		wc.Close()
+		we.Close()
+
+		a.ui.QueueUpdateDraw(func() {
+			if ctx.Err() != nil {
+				return
+			}
+
+			a.flush()
+			if a.pretty {
+				a.render()
+			}
+			a.mu.Lock()
+			a.keep = scrollPos{}
+			a.mu.Unlock()
+
+			a.ui.TimeView.SetText(formatDuration(elapsed))
+			if timedOut {
+				a.setStatus(statusTimeout)
+				return
+			}
+			if killed {
+				a.setStatus(statusKilled)
+				return
+			}
+			if exitStatus(err) < 0 {
+				a.fail(err)
+				return
+			}
+			a.setStatus(exitStatus(err))
+			if exitStatus(err) == 0 {
+				a.succeed(text)
+			}
+
+			a.mu.Lock()
+			a.silent = stdin.n > 0 && a.count.Bytes == 0
+			a.mu.Unlock()
+			a.updateSize()
+		})
+	}()
+}
+
+func (a *App) fail(err error) {
+	fmt.Fprintf(a.ui.MainView, "[%s]%s: %s[-]\n", a.cfg.StderrColor, getProgramName(), tview.Escape(errorMessage(err)))
+	a.setStatus(-1)
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func formatBytes(n int) string {
+	if n < 1<<10 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	v := float64(n) / (1 << 10)
+	i := 0
+	for v >= 1<<10 && i < len(units)-1 {
+		v /= 1 << 10
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
+
+func (a *App) setRunning(running bool) {
+	a.mu.Lock()
+	a.running = running
+	a.mu.Unlock()
+
+	a.spin = 0
+	a.ui.ExitView.SetText("")
+	if running && a.cfg.LowPower {
+		a.ui.ExitView.SetText("running").SetTextColor(a.cfg.Theme.Status)
+	}
+}
+
+func (a *App) stepSpinner() {
+	a.mu.Lock()
+	running := a.running
+	a.mu.Unlock()
+
+	if running {
+		a.spin = (a.spin + 1) % len(spinFrames)
+		a.ui.ExitView.SetText(spinFrames[a.spin]).SetTextColor(a.cfg.Theme.Status)
+	}
+}
+
+func (a *App) setStatus(status int) {
+	a.setRunning(false)
+	a.status = status
+	switch {
+	case status == 0:
+		a.ui.ExitView.SetText("exit 0").SetTextColor(a.cfg.Theme.Success)
+	case status > 0:
+		a.ui.ExitView.SetText(fmt.Sprintf("exit %d", status)).SetTextColor(a.cfg.Theme.Failure)
+	case status == statusTimeout:
+		a.ui.ExitView.SetText("timed out").SetTextColor(a.cfg.Theme.Warning)
+	case status == statusKilled:
+		a.ui.ExitView.SetText("killed").SetTextColor(a.cfg.Theme.Warning)
+	case status == statusNoCommand:
+		a.ui.ExitView.SetText("no command").SetTextColor(a.cfg.Theme.Warning)
+	default:
+		a.ui.ExitView.SetText("error").SetTextColor(a.cfg.Theme.Failure)
+	}
+}
+
+func (a *App) updateSize() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.ui.SetTruncated(a.truncation())
+
+	var text string
+	size := fmt.Sprintf("%10s", formatBytes(a.count.Bytes))
+	if a.cfg.RawBytes {
+		size = fmt.Sprintf("%6d bytes", a.count.Bytes)
+	}
+
+	switch a.metric {
+	case 0:
+		text = fmt.Sprintf("%6d lines %s", a.count.Lines, size)
+	case 1:
+		text = size
+	case 2:
+		text = fmt.Sprintf("%6d lines", a.count.Lines)
+	case 3:
+		text = fmt.Sprintf("%6d words", a.count.Words)
+	case 4:
+		text = fmt.Sprintf("%6d chars", a.count.Chars)
+	}
+
+	if a.bu.Dropped() > 0 || a.bi.Dropped() > 0 {
+		a.ui.SetSizeText("~"+text, a.cfg.Theme.Warning)
+		return
+	}
+	if a.silent {
+		a.ui.SetSizeText(fmt.Sprintf("%*s", len(text), "no output"), a.cfg.Theme.Warning)
+		return
+	}
+	a.ui.SetSizeText(text, a.cfg.Theme.Status)
+}
+
+// truncation describes the output dropped from the buffer or left out of the
+// view by MaxLines, or returns "" when all of it is shown.
+func (a *App) truncation() string {
+	if a.count.Bytes == 0 {
+		return ""
+	}
+
+	lines := a.bu.DroppedLines()
+	if n := a.count.Lines - a.cfg.MaxLines; a.cfg.MaxLines > 0 && n > lines {
+		lines = n
+	}
+
+	dropped := a.bu.Dropped()
+	switch {
+	case dropped > 0:
+		size := formatBytes(dropped)
+		if a.cfg.RawBytes {
+			size = fmt.Sprintf("%d bytes", dropped)
+		}
+		return fmt.Sprintf("… earlier output truncated (%d lines, %s dropped)", lines, size)
+	case lines > 0:
+		return fmt.Sprintf("… earlier output truncated (%d lines not shown)", lines)
+	}
+	return ""
+}
+
+// Clear empties the output views, the buffered output and their counts.
+func (a *App) Clear() {
+	a.discard(true)
+	a.mu.Lock()
+	a.resetOutput()
+	a.mu.Unlock()
+
+	a.ui.MainView.Clear()
+	a.ui.ErrView.Clear()
+	a.updateSize()
+}
+
+// resetOutput empties the buffered output, its counts and its stamps. It is
+// called with a.mu held.
+func (a *App) resetOutput() {
+	a.bu.Reset()
+	a.count = counter{}
+	a.silent = false
+	a.stamps = nil
+	a.stampBase = 0
+	a.midLine = false
+	a.errSpans = nil
+	a.shown = 0
+	a.shownLine = 1
+}
+
+// Kill stops the running command and keeps the output it has written so far.
+func (a *App) Kill() {
+	a.mu.Lock()
+	running := a.running
+	a.mu.Unlock()
+	if !running {
+		return
+	}
+
+	a.kill()
+	a.wc.Close()
+	a.we.Close()
+}
+
+func (a *App) Stop() {
+	a.wc.Close()
+	a.we.Close()
+	a.cancel()
+	a.drains.Wait()
+
+	a.setRunning(false)
+	a.discard(true)
+	a.ui.MainView.Clear()
+	a.ui.ErrView.Clear()
+}
+
+// Run starts the first command and blocks until the user quits. It returns
+// the exit status of the last run, or 1 when that run failed to start, was
+// killed or timed out. SIGTERM and SIGHUP stop the command and restore the
+// terminal, and Run then returns 128 plus the signal number.
+func (a *App) Run() (int, error) {
+	if err := a.prepare(); err != nil {
+		return -1, err
+	}
+
+	a.remember(a.ui.GetTypedText())
+	a.Start()
+
+	go a.refresh()
+	if a.cfg.Follow {
+		go a.follow()
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case sig := <-sigs:
+			a.ui.QueueUpdate(func() {
+				a.signal = sig.(syscall.Signal)
+				a.Stop()
+				a.ui.Stop()
+			})
+		case <-done:
+		}
+	}()
+
+	if err := a.ui.Run(); err != nil {
+		return -1, err
+	}
+	if a.signal != 0 {
+		return 128 + int(a.signal), nil
+	}
+	if a.status < 0 {
+		return 1, a.err
+	}
+	return a.status, a.err
+}
+
+// Batch runs the command once without the editor, copying its output to
+// stdout and stderr, and returns its exit status.
+func (a *App) Batch(stdout, stderr io.Writer) (int, error) {
+	if err := a.prepare(); err != nil {
+		return -1, err
+	}
+
+	ctx := context.Background()
+	if a.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.cfg.Timeout)
+		defer cancel()
+	}
+	if a.cfg.OutputFile != "" {
+		stdout = a.bu
+	} else if a.cfg.PlainOutput {
+		sw := &stripWriter{w: stdout}
+		defer sw.Flush()
+		stdout = sw
+	}
+
+	var err error
+	if a.commentedOut() {
+		_, err = io.Copy(stdout, a.bi.NewReader(ctx))
+	} else if a.cfg.RecordDelimiter != "" {
+		err = a.runRecords(ctx, a.ui.GetInputText(), a.bi.NewReader(ctx), stdout, stderr)
+	} else {
+		var cmd *exec.Cmd
+		if cmd, err = a.createCmd(ctx, a.ui.GetInputText()); err != nil {
+			return -1, err
+		}
+		cmd.Stdin = a.bi.NewReader(ctx)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err = cmd.Run()
+	}
+	if a.cfg.OutputFile != "" {
+		out := a.bu.Bytes()
+		if a.cfg.PlainOutput {
+			out = ansiPattern.ReplaceAll(out, nil)
+		}
+		if werr := ioutil.WriteFile(a.cfg.OutputFile, out, 0644); werr != nil {
+			return -1, werr
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return -1, fmt.Errorf("timed out after %s", a.cfg.Timeout)
+	}
+
+	status := exitStatus(err)
+	if status < 0 {
+		return status, fmt.Errorf("%s", errorMessage(err))
+	}
+	return status, nil
+}
+
+func (a *App) prepare() error {
+	shell, err := resolveShell(a.cfg.Shell)
+	if err != nil {
+		return err
+	}
+	a.shell = shell
+
+	if a.cfg.WorkDir != "" {
+		if fi, err := os.Stat(a.cfg.WorkDir); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return fmt.Errorf("%s: not a directory", a.cfg.WorkDir)
+		}
+	}
+
+	if a.cfg.OutputFile != "" && !a.cfg.Force {
+		if _, err := os.Stat(a.cfg.OutputFile); err == nil {
+			return fmt.Errorf("%s: file exists (use --force to overwrite)", a.cfg.OutputFile)
+		}
+	}
+	return nil
+}
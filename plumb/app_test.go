@@ -0,0 +1,187 @@
+package plumb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// runTestApp runs a on its simulation screen and returns a channel receiving
+// the status Run returns.
+func runTestApp(t *testing.T, a *App) <-chan int {
+	done := make(chan int, 1)
+	go func() {
+		status, err := a.Run()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- status
+	}()
+	return done
+}
+
+// onUI runs f in the event loop of a and waits for it.
+func onUI(a *App, f func()) {
+	done := make(chan struct{})
+	a.ui.QueueUpdate(func() {
+		f()
+		close(done)
+	})
+	<-done
+}
+
+// waitFor fails t unless cond, evaluated in the event loop, holds within a
+// few seconds.
+func waitFor(t *testing.T, a *App, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var ok bool
+		onUI(a, func() { ok = cond() })
+		if ok {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func shown(a *App) string {
+	return a.ui.MainView.GetText(true)
+}
+
+func TestKeys(t *testing.T) {
+	a, sim := newTestApp(t, Config{Command: "echo hello"})
+	a.hi.Lines = []string{"seq 3"}
+	a.hi.pos = len(a.hi.Lines)
+	done := runTestApp(t, a)
+
+	waitFor(t, a, "the first run", func() bool { return shown(a) == "hello\n" })
+
+	sim.InjectKey(tcell.KeyEnter, 0, 0)
+	waitFor(t, a, "Enter to save the command", func() bool {
+		return strings.Join(a.hi.Lines, ",") == "seq 3,echo hello"
+	})
+
+	sim.InjectKey(tcell.KeyCtrlP, 0, tcell.ModCtrl)
+	waitFor(t, a, "Ctrl-P to run the previous command", func() bool {
+		return a.ui.CmdInput.GetText() == "seq 3" && shown(a) == "1\n2\n3\n"
+	})
+
+	sim.InjectKey(tcell.KeyCtrlN, 0, tcell.ModCtrl)
+	waitFor(t, a, "Ctrl-N to run the next command", func() bool {
+		return a.ui.CmdInput.GetText() == "echo hello" && shown(a) == "hello\n"
+	})
+
+	sim.InjectKey(tcell.KeyCtrlL, 0, tcell.ModCtrl)
+	waitFor(t, a, "Ctrl-L to clear the output", func() bool { return shown(a) == "" })
+	sim.InjectKey(tcell.KeyRune, 'n', tcell.ModAlt)
+	waitFor(t, a, "Alt-N to show line numbers", func() bool { return a.lineNumbers })
+	if got := shown(a); got != "" {
+		t.Errorf("shown %q after clearing, want nothing", got)
+	}
+	if got := a.exported(); len(got) != 0 {
+		t.Errorf("exported %q after clearing, want nothing", got)
+	}
+
+	sim.InjectKey(tcell.KeyCtrlQ, 0, tcell.ModCtrl)
+	select {
+	case status := <-done:
+		if status != 0 {
+			t.Errorf("status = %d, want 0", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ctrl-Q did not quit")
+	}
+	if got := strings.Join(newHistory(a.cfg.HistoryFile).Lines, ","); got != "echo hello" {
+		t.Errorf("saved history = %q, want %q", got, "echo hello")
+	}
+}
+
+func TestKeysEmptyCommand(t *testing.T) {
+	a, sim := newTestApp(t, Config{Input: strings.NewReader("in\n")})
+	done := runTestApp(t, a)
+
+	waitFor(t, a, "the default command", func() bool { return shown(a) == "in\n" })
+	sim.InjectKey(tcell.KeyEnter, 0, 0)
+	sim.InjectKey(tcell.KeyEnter, 0, 0)
+	for _, r := range "wc -l" {
+		sim.InjectKey(tcell.KeyRune, r, 0)
+	}
+	waitFor(t, a, "typing to run the command", func() bool { return strings.TrimSpace(shown(a)) == "1" })
+	sim.InjectKey(tcell.KeyEnter, 0, 0)
+	sim.InjectKey(tcell.KeyEnter, 0, 0)
+	waitFor(t, a, "Enter to save the command", func() bool { return len(a.hi.Lines) > 0 })
+
+	sim.InjectKey(tcell.KeyCtrlQ, 0, tcell.ModCtrl)
+	<-done
+	if got := strings.Join(a.hi.Lines, ","); got != "wc -l" {
+		t.Errorf("history = %q, want %q", got, "wc -l")
+	}
+}
+
+func TestRelayoutKeepsPrompts(t *testing.T) {
+	a, _ := newTestApp(t, Config{})
+	a.startFind()
+	a.startSearch()
+	a.ui.SetTruncated("… earlier output truncated")
+
+	var prompts []string
+	for i := 0; i < a.ui.layout.GetItemCount(); i++ {
+		switch a.ui.layout.GetItem(i) {
+		case a.ui.FindInput:
+			prompts = append(prompts, "find")
+		case a.ui.SearchInput:
+			prompts = append(prompts, "search")
+		}
+	}
+	if got := strings.Join(prompts, ","); got != "find,search" {
+		t.Errorf("prompts after showing the banner = %q, want %q", got, "find,search")
+	}
+}
+
+func TestQuitDrainsBurst(t *testing.T) {
+	dir := t.TempDir()
+	mark := filepath.Join(dir, "written")
+	a, sim := newTestApp(t, Config{
+		Command:    "seq 1 100000; touch " + mark + "; exec sleep 10",
+		Shell:      "sh",
+		OutputFile: filepath.Join(dir, "out"),
+	})
+
+	// Keep the command line printed on exit out of the test output.
+	stderr := os.Stderr
+	os.Stderr, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stderr = stderr }()
+	done := runTestApp(t, a)
+
+	// Quit as soon as the burst is in the pipe, before the view catches up.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(mark); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the command did not write the burst")
+		}
+	}
+	sim.InjectKey(tcell.KeyCtrlC, 0, tcell.ModCtrl)
+	if status := <-done; status != 0 {
+		t.Errorf("status = %d, want 0 for quitting mid-run", status)
+	}
+
+	var want bytes.Buffer
+	for i := 1; i <= 100000; i++ {
+		fmt.Fprintf(&want, "%d\n", i)
+	}
+	if got := a.exported(); !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("exported %d bytes, want %d", len(got), want.Len())
+	}
+	if got, _ := ioutil.ReadFile(a.cfg.OutputFile); !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("saved %d bytes, want %d", len(got), want.Len())
+	}
+}
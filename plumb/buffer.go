@@ -0,0 +1,330 @@
+package plumb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+type ringBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	max     int
+	start   int
+	dropped int
+	lines   int
+}
+
+func newRingBuffer(max int) *ringBuffer {
+	return &ringBuffer{max: max}
+}
+
+func (rb *ringBuffer) Write(p []byte) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	n := len(p)
+	if rb.max <= 0 {
+		rb.buf = append(rb.buf, p...)
+		return n, nil
+	}
+
+	if len(p) >= rb.max {
+		rb.dropped += len(rb.buf) + len(p) - rb.max
+		rb.lines += countLines(rb.buf) + countLines(p[:len(p)-rb.max])
+		rb.buf = append(rb.buf[:0], p[len(p)-rb.max:]...)
+		rb.start = 0
+		return n, nil
+	}
+
+	if free := rb.max - len(rb.buf); free > 0 {
+		if free > len(p) {
+			free = len(p)
+		}
+		rb.buf = append(rb.buf, p[:free]...)
+		p = p[free:]
+	}
+
+	for len(p) > 0 {
+		m := len(rb.buf) - rb.start
+		if m > len(p) {
+			m = len(p)
+		}
+		rb.lines += countLines(rb.buf[rb.start : rb.start+m])
+		copy(rb.buf[rb.start:], p[:m])
+		rb.start = (rb.start + m) % len(rb.buf)
+		rb.dropped += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (rb *ringBuffer) Bytes() []byte {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	b := make([]byte, 0, len(rb.buf))
+	b = append(b, rb.buf[rb.start:]...)
+	return append(b, rb.buf[:rb.start]...)
+}
+
+// readAt copies the bytes from offset off, counted from the first byte ever
+// written, and returns the offset after them. Dropped bytes are skipped.
+func (rb *ringBuffer) readAt(p []byte, off int) (int, int) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if off < rb.dropped {
+		off = rb.dropped
+	}
+	i := off - rb.dropped
+	head, tail := rb.buf[rb.start:], rb.buf[:rb.start]
+
+	var n int
+	if i < len(head) {
+		n = copy(p, head[i:])
+		n += copy(p[n:], tail)
+	} else if i-len(head) < len(tail) {
+		n = copy(p, tail[i-len(head):])
+	}
+	return n, off + n
+}
+
+func (rb *ringBuffer) String() string {
+	return string(rb.Bytes())
+}
+
+func (rb *ringBuffer) Len() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	return len(rb.buf)
+}
+
+func (rb *ringBuffer) Dropped() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	return rb.dropped
+}
+
+// DroppedLines returns the number of line breaks in the dropped bytes.
+func (rb *ringBuffer) DroppedLines() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	return rb.lines
+}
+
+func (rb *ringBuffer) Reset() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.buf = rb.buf[:0]
+	rb.start = 0
+	rb.dropped = 0
+	rb.lines = 0
+}
+
+func countLines(p []byte) int {
+	return bytes.Count(p, []byte("\n"))
+}
+
+// countReader counts the bytes read from Reader.
+type countReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+type counter struct {
+	Bytes int
+	Lines int
+	Words int
+	Chars int
+
+	inWord  bool
+	partial []byte
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	c.Bytes += len(p)
+	for _, b := range p {
+		switch b {
+		case '\n':
+			c.Lines++
+			c.inWord = false
+		case ' ', '\t', '\r', '\v', '\f':
+			c.inWord = false
+		default:
+			if !c.inWord {
+				c.Words++
+			}
+			c.inWord = true
+		}
+	}
+	c.countRunes(p)
+	return len(p), nil
+}
+
+// countRunes counts the runes of p, holding back a rune split at its end
+// until the rest of it is written.
+func (c *counter) countRunes(p []byte) {
+	if len(c.partial) > 0 {
+		p = append(c.partial, p...)
+		c.partial = nil
+	}
+	for len(p) > 0 {
+		if !utf8.FullRune(p) {
+			c.partial = append([]byte(nil), p...)
+			return
+		}
+		_, size := utf8.DecodeRune(p)
+		c.Chars++
+		p = p[size:]
+	}
+}
+
+// inputBuffer reads its input once, in the background, so that every run
+// replays exactly the same bytes from the start and then follows the input
+// read since. A regular file is not buffered but read again on every run.
+type inputBuffer struct {
+	*ringBuffer
+	r    io.Reader
+	file *os.File
+	size int
+	once sync.Once
+
+	mu   sync.Mutex
+	wait chan struct{}
+	err  error
+}
+
+func newInputBuffer(r io.Reader, max, size int) *inputBuffer {
+	ib := &inputBuffer{
+		ringBuffer: newRingBuffer(max),
+		r:          r,
+		size:       size,
+		wait:       make(chan struct{}),
+	}
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			ib.file = f
+		}
+	}
+	return ib
+}
+
+func (ib *inputBuffer) start() {
+	if ib.file != nil {
+		return
+	}
+	ib.once.Do(func() { go ib.fill() })
+}
+
+func (ib *inputBuffer) fill() {
+	b := make([]byte, ib.size)
+	for {
+		n, err := ib.r.Read(b)
+		ib.mu.Lock()
+		ib.ringBuffer.Write(b[:n])
+		ib.err = err
+		close(ib.wait)
+		ib.wait = make(chan struct{})
+		ib.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Size returns the number of bytes read so far, including dropped ones.
+func (ib *inputBuffer) Size() int {
+	if ib.file != nil {
+		fi, err := ib.file.Stat()
+		if err != nil {
+			return 0
+		}
+		return int(fi.Size())
+	}
+
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+
+	return ib.Len() + ib.Dropped()
+}
+
+// NewReader returns a reader of the input from the start that waits for more
+// of it until EOF or until ctx is done.
+func (ib *inputBuffer) NewReader(ctx context.Context) io.Reader {
+	if ib.file != nil {
+		return &fileReader{f: ib.file, ctx: ctx}
+	}
+	ib.start()
+	return &inputReader{ib: ib, ctx: ctx}
+}
+
+// Snapshot returns a reader of the input read so far.
+func (ib *inputBuffer) Snapshot() io.Reader {
+	if ib.file != nil {
+		return io.NewSectionReader(ib.file, 0, int64(ib.Size()))
+	}
+	return bytes.NewReader(ib.Bytes())
+}
+
+// fileReader reads a file from the start with ReadAt, so that the readers of
+// overlapping runs do not share an offset.
+type fileReader struct {
+	f   *os.File
+	ctx context.Context
+	off int64
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.f.ReadAt(p, r.off)
+	r.off += int64(n)
+	return n, err
+}
+
+// inputReader reads the buffered input from its own offset. The error that
+// ended the input is only returned once every byte before it has been read,
+// so each run after EOF still sees the whole input.
+type inputReader struct {
+	ib  *inputBuffer
+	ctx context.Context
+	off int
+}
+
+func (r *inputReader) Read(p []byte) (int, error) {
+	for {
+		r.ib.mu.Lock()
+		n, off := r.ib.readAt(p, r.off)
+		err, wait := r.ib.err, r.ib.wait
+		r.ib.mu.Unlock()
+
+		r.off = off
+		if n > 0 || len(p) == 0 {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-wait:
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package plumb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readAll reads rb from off with readAt through a small buffer.
+func readAll(rb *ringBuffer, off int) ([]byte, int) {
+	var out []byte
+	p := make([]byte, 3)
+	for {
+		n, next := rb.readAt(p, off)
+		if n == 0 {
+			return out, next
+		}
+		out = append(out, p[:n]...)
+		off = next
+	}
+}
+
+func TestRingBufferTiny(t *testing.T) {
+	const max = 8
+	rb := newRingBuffer(max)
+
+	var all []byte
+	for i, w := range []string{"0123456789\nabcdef", "g\n", "hij", "klmnopqrstuvwxyz\n", "1\n2\n3"} {
+		rb.Write([]byte(w))
+		all = append(all, w...)
+
+		want := all
+		if len(want) > max {
+			want = want[len(want)-max:]
+		}
+		if got := rb.Bytes(); !bytes.Equal(got, want) {
+			t.Fatalf("write %d: Bytes = %q, want %q", i, got, want)
+		}
+		if got, off := readAll(rb, 0); !bytes.Equal(got, want) || off != len(all) {
+			t.Fatalf("write %d: readAt = %q up to %d, want %q up to %d", i, got, off, want, len(all))
+		}
+		if got, want := rb.Dropped(), len(all)-len(want); got != want {
+			t.Fatalf("write %d: Dropped = %d, want %d", i, got, want)
+		}
+		if got, want := rb.DroppedLines(), countLines(all[:rb.Dropped()]); got != want {
+			t.Fatalf("write %d: DroppedLines = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestRingBufferFollow(t *testing.T) {
+	rb := newRingBuffer(16)
+
+	var all, got []byte
+	off := 0
+	for i := 0; i < 100; i++ {
+		w := []byte(fmt.Sprintf("%d,", i))
+		rb.Write(w)
+		all = append(all, w...)
+
+		var b []byte
+		b, off = readAll(rb, off)
+		got = append(got, b...)
+	}
+	if !bytes.Equal(got, all) {
+		t.Errorf("read %q, want %q", got, all)
+	}
+}
+
+// trickleReader returns its data a few bytes at a time, pausing before each
+// read like a slow pipe.
+type trickleReader struct {
+	data  []byte
+	chunk int
+}
+
+func (r *trickleReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(100 * time.Microsecond)
+	n := r.chunk
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	n = copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func trickleData() []byte {
+	var b bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.Bytes()
+}
+
+func TestInputBufferReplay(t *testing.T) {
+	data := trickleData()
+	ib := newInputBuffer(&trickleReader{data: data, chunk: 7}, 0, 16)
+
+	// Start runs while the input is still arriving, each replaying it
+	// from the start.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := ioutil.ReadAll(ib.NewReader(context.Background()))
+			if err != nil {
+				t.Errorf("run %d: %v", i, err)
+			} else if !bytes.Equal(got, data) {
+				t.Errorf("run %d: read %d bytes, want %d", i, len(got), len(data))
+			}
+		}(i)
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+}
+
+func TestInputBufferAfterEOF(t *testing.T) {
+	data := trickleData()
+	ib := newInputBuffer(&trickleReader{data: data, chunk: 5}, 0, 16)
+
+	for i := 0; i < 3; i++ {
+		got, err := ioutil.ReadAll(ib.NewReader(context.Background()))
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("run %d: read %d bytes, want %d", i, len(got), len(data))
+		}
+	}
+	if got := ib.Size(); got != len(data) {
+		t.Errorf("Size = %d, want %d", got, len(data))
+	}
+}
+
+func TestInputBufferFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	if err := ioutil.WriteFile(path, []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ib := newInputBuffer(f, 0, 16)
+	if ib.file == nil {
+		t.Fatal("a regular file is buffered")
+	}
+	for _, want := range []string{"one\n", "one\ntwo\n", "three\n"} {
+		if err := ioutil.WriteFile(path, []byte(want), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(ib.NewReader(context.Background()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("read %q, want %q", got, want)
+		}
+		if ib.Size() != len(want) {
+			t.Errorf("Size = %d, want %d", ib.Size(), len(want))
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package plumb
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var clipboardCommands = []struct {
+	env  string
+	args []string
+}{
+	{"", []string{"pbcopy"}},
+	{"WAYLAND_DISPLAY", []string{"wl-copy"}},
+	{"DISPLAY", []string{"xclip", "-selection", "clipboard"}},
+	{"DISPLAY", []string{"xsel", "--clipboard", "--input"}},
+	{"", []string{"clip.exe"}},
+}
+
+func copyToClipboard(text string) error {
+	for _, c := range clipboardCommands {
+		if c.env != "" && os.Getenv(c.env) == "" {
+			continue
+		}
+
+		path, err := exec.LookPath(c.args[0])
+		if err != nil {
+			continue
+		}
+
+		cmd := exec.Command(path, c.args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return fmt.Errorf("no clipboard command found")
+}
@@ -0,0 +1,54 @@
+package plumb
+
+import (
+	"github.com/gdamore/tcell/v2"
+)
+
+// ColorModes are the values Config.ColorMode accepts, from the most colors
+// to none.
+var ColorModes = []string{"truecolor", "256", "16", "mono"}
+
+// colorScreen draws every color as the closest one of the first colors of
+// the palette, or as the default color when the palette is empty.
+type colorScreen struct {
+	tcell.Screen
+	palette []tcell.Color
+	fitted  map[tcell.Color]tcell.Color
+}
+
+func newColorScreen(s tcell.Screen, colors int) *colorScreen {
+	palette := make([]tcell.Color, colors)
+	for i := range palette {
+		palette[i] = tcell.PaletteColor(i)
+	}
+	return &colorScreen{Screen: s, palette: palette, fitted: make(map[tcell.Color]tcell.Color)}
+}
+
+func (s *colorScreen) color(c tcell.Color) tcell.Color {
+	if c == tcell.ColorDefault {
+		return c
+	}
+	v, ok := s.fitted[c]
+	if !ok {
+		v = tcell.FindColor(c, s.palette)
+		s.fitted[c] = v
+	}
+	return v
+}
+
+func (s *colorScreen) style(style tcell.Style) tcell.Style {
+	fg, bg, _ := style.Decompose()
+	return style.Foreground(s.color(fg)).Background(s.color(bg))
+}
+
+func (s *colorScreen) SetContent(x, y int, mainc rune, combc []rune, style tcell.Style) {
+	s.Screen.SetContent(x, y, mainc, combc, s.style(style))
+}
+
+func (s *colorScreen) SetStyle(style tcell.Style) {
+	s.Screen.SetStyle(s.style(style))
+}
+
+func (s *colorScreen) Fill(r rune, style tcell.Style) {
+	s.Screen.Fill(r, s.style(style))
+}
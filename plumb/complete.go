@@ -0,0 +1,74 @@
+package plumb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type completion struct {
+	prefix  string
+	matches []string
+	pos     int
+	text    string
+}
+
+func (a *App) complete() {
+	text := a.ui.CmdInput.GetText()
+	c := &a.completion
+	if text != c.text || len(c.matches) == 0 {
+		i := strings.LastIndexAny(text, " \t|<>;&()'\"") + 1
+		c.prefix = text[:i]
+		c.matches = completePath(text[i:], a.cfg.WorkDir)
+		c.pos = 0
+	} else {
+		c.pos = (c.pos + 1) % len(c.matches)
+	}
+	if len(c.matches) == 0 {
+		return
+	}
+
+	c.text = c.prefix + c.matches[c.pos]
+	a.ui.CmdInput.SetText(c.text)
+}
+
+func completePath(token, workDir string) []string {
+	dir, base := filepath.Split(token)
+	path := dir
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, path[2:])
+	}
+	if path == "" {
+		path = "."
+	}
+	if !filepath.IsAbs(path) && workDir != "" {
+		path = filepath.Join(workDir, path)
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+
+	var matches []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		} else if e.Mode()&os.ModeSymlink != 0 {
+			if fi, err := os.Stat(filepath.Join(path, name)); err == nil && fi.IsDir() {
+				name += "/"
+			}
+		}
+		matches = append(matches, dir+name)
+	}
+	return matches
+}
@@ -0,0 +1,144 @@
+package plumb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// maxDiffEdits bounds the work of a diff; longer edit scripts show the
+// changed lines as all removed and then all added.
+const maxDiffEdits = 1000
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines returns the edit script turning a into b, with ' ' for the lines
+// kept, '-' for the lines of a removed and '+' for the lines of b added.
+func diffLines(a, b []string) []diffLine {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var edits []diffLine
+	for _, s := range a[:pre] {
+		edits = append(edits, diffLine{' ', s})
+	}
+	edits = append(edits, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, s := range a[len(a)-suf:] {
+		edits = append(edits, diffLine{' ', s})
+	}
+	return edits
+}
+
+// myers implements the O(ND) diff by Eugene W. Myers.
+func myers(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+
+	off := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+
+	edits := make([]diffLine, 0, n+m)
+	for _, s := range a {
+		edits = append(edits, diffLine{'-', s})
+	}
+	for _, s := range b {
+		edits = append(edits, diffLine{'+', s})
+	}
+	return edits
+}
+
+func backtrack(trace [][]int, a, b []string) []diffLine {
+	var edits []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		at := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		prev := k - 1
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prev = k + 1
+		}
+		px := at(prev)
+		py := px - prev
+		for x > px && y > py {
+			x--
+			y--
+			edits = append(edits, diffLine{' ', a[x]})
+		}
+		if x == px {
+			y--
+			edits = append(edits, diffLine{'+', b[y]})
+		} else {
+			x--
+			edits = append(edits, diffLine{'-', a[x]})
+		}
+	}
+	for x > 0 {
+		x--
+		edits = append(edits, diffLine{' ', a[x]})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// colorDiff shows the lines of cur added since prev and the lines removed
+// from it, without ANSI sequences.
+func (a *App) colorDiff(prev, cur []byte) string {
+	split := func(p []byte) []string {
+		text := ansiPattern.ReplaceAllString(sanitize(bytes.TrimSuffix(p, []byte("\n"))), "")
+		if text == "" {
+			return nil
+		}
+		return strings.Split(text, "\n")
+	}
+
+	var b strings.Builder
+	for _, e := range diffLines(split(prev), split(cur)) {
+		switch e.op {
+		case '+':
+			fmt.Fprintf(&b, "[%s]+ %s[-]\n", colorTag(a.cfg.Theme.Success), tview.Escape(e.text))
+		case '-':
+			fmt.Fprintf(&b, "[%s]- %s[-]\n", colorTag(a.cfg.Theme.Failure), tview.Escape(e.text))
+		default:
+			fmt.Fprintf(&b, "  %s\n", tview.Escape(e.text))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,225 @@
+package plumb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/creack/pty"
+)
+
+func (a *App) createCmd(ctx context.Context, text string) (*exec.Cmd, error) {
+	cmdArgs := strings.Fields(text)
+	if len(cmdArgs) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+
+	var cmd *exec.Cmd
+	if a.shell != "" {
+		if a.cfg.Pre != "" {
+			text = a.cfg.Pre + "\n" + text
+		}
+		cmd = exec.CommandContext(ctx, a.shell, "-c", text)
+	} else {
+		cmd = exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	}
+
+	cmd.Dir = a.cfg.WorkDir
+	if len(a.cfg.Env) > 0 {
+		cmd.Env = append(os.Environ(), a.cfg.Env...)
+	}
+	return cmd, nil
+}
+
+const maxRecordSize = 64 << 20
+
+// runRecords splits r into records at RecordDelimiter and runs text once per
+// record, with the record and a final newline as its stdin. A record whose
+// command exits non-zero does not stop the others; the last such exit is
+// returned.
+func (a *App) runRecords(ctx context.Context, text string, r io.Reader, stdout, stderr io.Writer) error {
+	delim := []byte(a.cfg.RecordDelimiter)
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, a.cfg.BufferSize), maxRecordSize)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.Index(data, delim); i >= 0 {
+			return i + len(delim), data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	var last error
+	for s.Scan() {
+		record := s.Bytes()
+		if !bytes.HasSuffix(record, []byte("\n")) {
+			record = append(record[:len(record):len(record)], '\n')
+		}
+
+		cmd, err := a.createCmd(ctx, text)
+		if err != nil {
+			return err
+		}
+		cmd.Stdin = bytes.NewReader(record)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			if exitStatus(err) < 0 || ctx.Err() != nil {
+				return err
+			}
+			last = err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return last
+}
+
+// commentedOut reports whether the command starts with "#", in which case
+// the input is passed through without running anything.
+func (a *App) commentedOut() bool {
+	return strings.HasPrefix(a.ui.GetInputText(), "#")
+}
+
+// explain describes how the command would be run without running it.
+func (a *App) explain() string {
+	if a.commentedOut() {
+		return "commented out: the input is shown unchanged\n"
+	}
+	cmd, err := a.createCmd(context.Background(), a.ui.GetInputText())
+	if err != nil {
+		return errorMessage(err) + "\n"
+	}
+
+	args := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		args[i] = fmt.Sprintf("%q", arg)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "path  %s\n", cmd.Path)
+	fmt.Fprintf(&b, "argv  %s\n", strings.Join(args, " "))
+	if cmd.Dir != "" {
+		fmt.Fprintf(&b, "dir   %s\n", cmd.Dir)
+	}
+	for _, env := range a.cfg.Env {
+		fmt.Fprintf(&b, "env   %s\n", env)
+	}
+	if a.cfg.PTY {
+		b.WriteString("pty   stdout and stderr go to a pseudo-terminal\n")
+	}
+	if a.cfg.Timeout > 0 {
+		fmt.Fprintf(&b, "stop  after %s\n", a.cfg.Timeout)
+	}
+	return b.String()
+}
+
+// openPTY attaches the stdout and stderr of cmd to a new pseudo-terminal of
+// the given size and returns its master side along with the terminal, which
+// the caller closes once cmd has started.
+func openPTY(cmd *exec.Cmd, cols, rows int) (io.ReadWriteCloser, *os.File, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	pty.Setsize(ptmx, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	return &crlfReader{File: ptmx}, tty, nil
+}
+
+// crlfReader turns the CRLF line endings written by a terminal back into LF.
+// A CR ending a read is held back until the next one tells whether an LF
+// follows it.
+type crlfReader struct {
+	*os.File
+	held []byte // a byte read but not returned yet, a CR unless p had no room
+}
+
+func (c *crlfReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(c.held) > 0 && len(p) == 1 {
+		return c.readOne(p)
+	}
+
+	off := copy(p, c.held)
+	c.held = nil
+	n, err := c.File.Read(p[off:])
+	n += off
+	if err == nil && n > 0 && p[n-1] == '\r' {
+		c.held = []byte{'\r'}
+		if n--; n == 0 {
+			return c.readOne(p)
+		}
+	}
+	return copy(p, bytes.Replace(p[:n], []byte("\r\n"), []byte("\n"), -1)), err
+}
+
+// readOne returns the held byte in p, reading the next byte to tell whether a
+// held CR is part of a CRLF. A read error is left for the next Read to hit.
+func (c *crlfReader) readOne(p []byte) (int, error) {
+	held := c.held[0]
+	c.held = nil
+	if held != '\r' {
+		p[0] = held
+		return 1, nil
+	}
+
+	n, _ := c.File.Read(p[:1])
+	switch {
+	case n == 1 && p[0] == '\n':
+		return 1, nil
+	case n == 1:
+		c.held = []byte{p[0]}
+	}
+	p[0] = '\r'
+	return 1, nil
+}
+
+func resolveShell(name string) (string, error) {
+	switch name {
+	case "":
+		if shell := os.Getenv("SHELL"); shell != "" {
+			return shell, nil
+		}
+		shell, _ := exec.LookPath("sh")
+		return shell, nil
+	case "none":
+		return "", nil
+	}
+
+	shell, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("shell not found: %s", name)
+	}
+	return shell, nil
+}
+
+func errorMessage(err error) string {
+	if e, ok := err.(*exec.Error); ok && e.Err == exec.ErrNotFound {
+		return fmt.Sprintf("command not found: %s", e.Name)
+	}
+	return err.Error()
+}
+
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if ee, ok := err.(*exec.ExitError); ok {
+		return ee.ExitCode()
+	}
+	return -1
+}
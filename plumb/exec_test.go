@@ -0,0 +1,86 @@
+package plumb
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCRLFReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"whole lines", []string{"a\r\nb\r\n"}, "a\nb\n"},
+		{"split pair", []string{"a\r", "\nb\r", "\n"}, "a\nb\n"},
+		{"lone CR", []string{"a\rb\r", "c"}, "a\rb\rc"},
+		{"CR at the end", []string{"a\r"}, "a\r"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			// Read after each write so that the reads split where the
+			// writes do.
+			c := &crlfReader{File: r}
+			var got []byte
+			p := make([]byte, 64)
+			for _, s := range tt.writes {
+				w.WriteString(s)
+				n, err := c.Read(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, p[:n]...)
+			}
+			w.Close()
+			rest, err := ioutil.ReadAll(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got = append(got, rest...); string(got) != tt.want {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCRLFReaderByByte(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"a\r\nb\r\n", "a\nb\n"},
+		{"a\rb\r\r\nc\r", "a\rb\r\nc\r"},
+	} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteString(tt.in)
+		w.Close()
+
+		// Read one byte at a time, as with --buffer-size 1.
+		c := &crlfReader{File: r}
+		var got []byte
+		p := make([]byte, 1)
+		for {
+			n, err := c.Read(p)
+			got = append(got, p[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		r.Close()
+		if string(got) != tt.want {
+			t.Errorf("read %q, want %q", got, tt.want)
+		}
+	}
+}
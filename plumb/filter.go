@@ -0,0 +1,69 @@
+package plumb
+
+import (
+	"bytes"
+	"regexp"
+)
+
+func (a *App) startFilter() {
+	a.ui.layout.RemoveItem(a.ui.FilterInput)
+	a.ui.layout.AddItem(a.ui.FilterInput, 1, 0, true)
+	a.ui.SetFocus(a.ui.FilterInput)
+	a.updateFilter()
+}
+
+func (a *App) stopFilter(keep bool) {
+	a.ui.SetFocus(a.ui.Editor())
+	if keep && a.filter != nil {
+		return
+	}
+
+	a.ui.layout.RemoveItem(a.ui.FilterInput)
+	a.ui.FilterInput.SetText("")
+	a.filter = nil
+	a.render()
+}
+
+func (a *App) updateFilter() {
+	label := "filter: "
+	if a.filterInvert {
+		label = "filter (-v): "
+	}
+	a.ui.FilterInput.SetLabel(label).SetLabelColor(a.cfg.Theme.Status)
+
+	query := a.ui.FilterInput.GetText()
+	if query == "" {
+		a.filter = nil
+		a.render()
+		return
+	}
+
+	re, err := regexp.Compile(query)
+	if err != nil {
+		a.ui.FilterInput.SetLabelColor(a.cfg.Theme.Failure)
+		return
+	}
+	a.filter = re
+	a.render()
+}
+
+func (a *App) filterLines(p []byte) []byte {
+	if a.filter == nil {
+		return p
+	}
+
+	var b bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if a.keepLine(line) {
+			b.Write(line)
+		}
+	}
+	return b.Bytes()
+}
+
+func (a *App) keepLine(line []byte) bool {
+	if len(line) == 0 {
+		return false
+	}
+	return a.filter == nil || a.filter.Match(ansiPattern.ReplaceAll(line, nil)) != a.filterInvert
+}
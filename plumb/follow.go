@@ -0,0 +1,27 @@
+package plumb
+
+import "time"
+
+const followInterval = time.Second / 2
+
+// follow reads the input on its own and re-runs the command once it has
+// finished and more input has arrived, so that each run sees the input so far
+// up to EOF and commands that buffer their output still show it.
+func (a *App) follow() {
+	a.bi.start()
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	seen := 0
+	for range ticker.C {
+		a.mu.Lock()
+		running := a.running
+		a.mu.Unlock()
+
+		if size := a.bi.Size(); size != seen && !running {
+			seen = size
+			a.ui.QueueUpdateDraw(a.Restart)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package plumb
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type history struct {
+	pos   int
+	path  string
+	draft string
+	Lines []string
+}
+
+func getHistoryPath() string {
+	if path := os.Getenv("GOPLUMB_HISTFILE"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".goplumb_history")
+}
+
+func newHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := s.Text(); line != "" {
+			h.Lines = append(h.Lines, line)
+		}
+	}
+
+	h.pos = len(h.Lines)
+	return h
+}
+
+// Prev returns the previous entry that differs from text. Leaving the line
+// after the newest entry keeps text there as a draft for Next to restore.
+func (h *history) Prev(text string) string {
+	if h.pos >= len(h.Lines) {
+		h.pos = len(h.Lines)
+		h.draft = text
+	}
+
+	for i := h.pos - 1; i >= 0; i-- {
+		if h.Lines[i] != text {
+			h.pos = i
+			return h.Lines[i]
+		}
+	}
+	return text
+}
+
+// Next returns the next entry that differs from text, or the draft after
+// the newest entry.
+func (h *history) Next(text string) string {
+	if h.pos < 0 || h.pos >= len(h.Lines) {
+		return text
+	}
+
+	for i := h.pos + 1; i < len(h.Lines); i++ {
+		if h.Lines[i] != text {
+			h.pos = i
+			return h.Lines[i]
+		}
+	}
+	h.pos = len(h.Lines)
+	return h.draft
+}
+
+func (h *history) Search(query string, pos int) int {
+	if pos > len(h.Lines) {
+		pos = len(h.Lines)
+	}
+
+	for i := pos - 1; i >= 0; i-- {
+		if strings.Contains(h.Lines[i], query) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *history) Append(line string) {
+	line = joinLines(line)
+	if line == "" {
+		return
+	}
+	if len(h.Lines) == 0 || h.Lines[len(h.Lines)-1] != line {
+		h.save(line)
+		h.Lines = append(h.Lines, line)
+	}
+	h.pos = len(h.Lines)
+	h.draft = ""
+}
+
+func (h *history) save(line string) {
+	if h.path == "" {
+		return
+	}
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, line)
+}
+
+func joinLines(text string) string {
+	var parts []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		n := len(parts)
+		if n == 0 {
+			parts = append(parts, line)
+			continue
+		}
+
+		prev := parts[n-1]
+		switch {
+		case strings.HasSuffix(prev, "\\"):
+			parts[n-1] = strings.TrimSpace(strings.TrimSuffix(prev, "\\")) + " " + line
+		case continues(prev):
+			parts[n-1] = prev + " " + line
+		default:
+			parts[n-1] = prev + "; " + line
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func continues(line string) bool {
+	for _, s := range []string{"|", "&", ";", "(", "{"} {
+		if strings.HasSuffix(line, s) {
+			return true
+		}
+	}
+
+	fields := strings.Fields(line)
+	switch fields[len(fields)-1] {
+	case "do", "then", "else", "in":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package plumb
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistoryLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := ioutil.WriteFile(path, []byte("ls\n\ngrep foo\nsort\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newHistory(path)
+	if want := []string{"ls", "grep foo", "sort"}; !reflect.DeepEqual(h.Lines, want) {
+		t.Errorf("Lines = %q, want %q", h.Lines, want)
+	}
+	if got := h.Prev(""); got != "sort" {
+		t.Errorf("Prev = %q, want %q", got, "sort")
+	}
+
+	h = newHistory(filepath.Join(t.TempDir(), "missing"))
+	if len(h.Lines) != 0 {
+		t.Errorf("Lines = %q, want none", h.Lines)
+	}
+}
+
+func TestHistoryPrevNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		draft string
+		moves string
+		want  []string
+	}{
+		{"empty", nil, "draft", "pn", []string{"draft", "draft"}},
+		{"back to the oldest", []string{"a", "b", "c"}, "", "pppp", []string{"c", "b", "a", "a"}},
+		{"forward to the draft", []string{"a", "b"}, "dr", "ppnnn", []string{"b", "a", "b", "dr", "dr"}},
+		{"next before prev", []string{"a", "b"}, "dr", "np", []string{"dr", "b"}},
+		{"skips the same text", []string{"a", "b", "b"}, "b", "p", []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &history{Lines: tt.lines, pos: len(tt.lines)}
+			text := tt.draft
+			var got []string
+			for _, m := range tt.moves {
+				if m == 'p' {
+					text = h.Prev(text)
+				} else {
+					text = h.Next(text)
+				}
+				got = append(got, text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := newHistory(path)
+	h.Append("ls")
+	h.Append("sort |\n  uniq")
+	h.Prev("")
+	h.Append("grep foo")
+
+	want := []string{"ls", "sort | uniq", "grep foo"}
+	if !reflect.DeepEqual(h.Lines, want) {
+		t.Errorf("Lines = %q, want %q", h.Lines, want)
+	}
+	if got := h.Next("x"); got != "x" {
+		t.Errorf("Next after Append = %q, want %q", got, "x")
+	}
+	if got := newHistory(path).Lines; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved Lines = %q, want %q", got, want)
+	}
+}
+
+func TestHistoryAppendSkips(t *testing.T) {
+	tests := []struct {
+		name    string
+		appends []string
+		want    []string
+	}{
+		{"same command", []string{"ls", "ls", "ls", "ls"}, []string{"ls"}},
+		{"same after joining", []string{"ls |\nwc", "ls | wc"}, []string{"ls | wc"}},
+		{"empty", []string{"", "ls", ""}, []string{"ls"}},
+		{"blank lines", []string{" \n\t\n"}, nil},
+		{"only the last one", []string{"ls", "wc", "ls"}, []string{"ls", "wc", "ls"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history")
+			h := newHistory(path)
+			for _, line := range tt.appends {
+				h.Append(line)
+			}
+			if !reflect.DeepEqual(h.Lines, tt.want) {
+				t.Errorf("Lines = %q, want %q", h.Lines, tt.want)
+			}
+			if got := newHistory(path).Lines; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("saved Lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
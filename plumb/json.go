@@ -0,0 +1,69 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+func prettyJSON(p []byte) ([]byte, bool) {
+	var b bytes.Buffer
+	dec := json.NewDecoder(bytes.NewReader(p))
+	for {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, false
+		}
+		if err := json.Indent(&b, v, "", "  "); err != nil {
+			return nil, false
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), b.Len() > 0
+}
+
+func (a *App) colorJSON(p []byte) string {
+	if a.cfg.NoColor {
+		return tview.Escape(string(p))
+	}
+
+	t := a.cfg.Theme
+	var b strings.Builder
+	for i := 0; i < len(p); {
+		c := p[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for j < len(p) && p[j] != '"' {
+				if p[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j++
+			color := t.Success
+			if k := bytes.IndexFunc(p[j:], func(r rune) bool { return r != ' ' }); k >= 0 && p[j+k] == ':' {
+				color = t.Label
+			}
+			fmt.Fprintf(&b, "[%s]%s[-]", colorTag(color), tview.Escape(string(p[i:j])))
+			i = j
+		case c == '-' || c >= '0' && c <= '9' || c == 't' || c == 'f' || c == 'n':
+			j := i + 1
+			for j < len(p) && bytes.IndexByte([]byte(",]} \n"), p[j]) < 0 {
+				j++
+			}
+			fmt.Fprintf(&b, "[%s]%s[-]", colorTag(t.Warning), p[i:j])
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
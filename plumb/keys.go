@@ -0,0 +1,301 @@
+package plumb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+type action int
+
+const (
+	actionNone action = iota
+	actionQuit
+	actionAbort
+	actionRun
+	actionHistoryPrev
+	actionHistoryNext
+	actionHistorySearch
+	actionFind
+	actionFilter
+	actionToggleAutoRun
+	actionToggleWrap
+	actionToggleMultiline
+	actionCycleCount
+	actionToggleSplit
+	actionToggleBinary
+	actionToggleJSON
+	actionToggleTable
+	actionToggleDiff
+	actionToggleFreeze
+	actionToggleLineNumbers
+	actionCursorLeft
+	actionCursorRight
+	actionDeleteChar
+	actionComplete
+	actionKill
+	actionClear
+	actionCopyCommand
+	actionCopyOutput
+	actionSelect
+	actionFocus
+	actionStdin
+	actionPager
+	actionSaveSnippet
+	actionPickSnippet
+	actionPickHistory
+	actionExplain
+	actionHelp
+)
+
+var actionNames = []string{
+	actionQuit:              "quit",
+	actionAbort:             "abort",
+	actionRun:               "run",
+	actionHistoryPrev:       "history-prev",
+	actionHistoryNext:       "history-next",
+	actionHistorySearch:     "history-search",
+	actionFind:              "find",
+	actionFilter:            "filter",
+	actionToggleAutoRun:     "toggle-auto-run",
+	actionToggleWrap:        "toggle-wrap",
+	actionToggleMultiline:   "toggle-multiline",
+	actionCycleCount:        "cycle-count",
+	actionToggleSplit:       "toggle-split",
+	actionToggleBinary:      "toggle-binary",
+	actionToggleJSON:        "toggle-json",
+	actionToggleTable:       "toggle-table",
+	actionToggleDiff:        "toggle-diff",
+	actionToggleFreeze:      "toggle-freeze",
+	actionToggleLineNumbers: "toggle-line-numbers",
+	actionCursorLeft:        "cursor-left",
+	actionCursorRight:       "cursor-right",
+	actionDeleteChar:        "delete-char",
+	actionComplete:          "complete",
+	actionKill:              "kill",
+	actionClear:             "clear",
+	actionCopyCommand:       "copy-command",
+	actionCopyOutput:        "copy-output",
+	actionSelect:            "select",
+	actionFocus:             "focus",
+	actionStdin:             "stdin",
+	actionPager:             "pager",
+	actionSaveSnippet:       "save-snippet",
+	actionPickSnippet:       "pick-snippet",
+	actionPickHistory:       "pick-history",
+	actionExplain:           "explain",
+	actionHelp:              "help",
+}
+
+var actionHelps = []string{
+	actionQuit:              "quit and print the output",
+	actionAbort:             "quit without printing or saving anything",
+	actionRun:               "run the command and save it to the history",
+	actionHistoryPrev:       "previous command in the history",
+	actionHistoryNext:       "next command in the history",
+	actionHistorySearch:     "search the history",
+	actionFind:              "find text in the output",
+	actionFilter:            "show only the output lines matching a regexp",
+	actionToggleAutoRun:     "toggle running the command while typing",
+	actionToggleWrap:        "toggle line wrapping",
+	actionToggleMultiline:   "toggle multi-line editing of the command",
+	actionCycleCount:        "cycle the line, byte, word and character counts",
+	actionToggleSplit:       "toggle the stderr pane",
+	actionToggleBinary:      "toggle the hex dump of binary output",
+	actionToggleJSON:        "toggle pretty-printing of JSON output",
+	actionToggleTable:       "toggle aligning the columns of the output",
+	actionToggleDiff:        "toggle the diff against the previous run's output",
+	actionToggleFreeze:      "toggle a frozen copy of the output beside it",
+	actionToggleLineNumbers: "toggle the line numbers",
+	actionCursorLeft:        "move the cursor left",
+	actionCursorRight:       "move the cursor right",
+	actionDeleteChar:        "delete the character under the cursor",
+	actionComplete:          "complete a file path",
+	actionKill:              "stop the running command and keep its output",
+	actionClear:             "clear the output without re-running",
+	actionCopyCommand:       "copy the command to the clipboard",
+	actionCopyOutput:        "copy the whole output to the clipboard",
+	actionSelect:            "select lines of the output to copy",
+	actionFocus:             "move the focus between the command and the output",
+	actionStdin:             "type the input with --interactive-stdin",
+	actionPager:             "show the output in $PAGER",
+	actionSaveSnippet:       "save the command as a named snippet",
+	actionPickSnippet:       "load a saved snippet",
+	actionPickHistory:       "fuzzy-find a command in the history and snippets",
+	actionExplain:           "show how the command will be run",
+	actionHelp:              "show this help",
+}
+
+var fixedHelps = [][2]string{
+	{"Alt-Enter", "run the command while editing multiple lines"},
+	{"PgUp, PgDn", "scroll the output"},
+	{"Home, End", "jump to the top or bottom of the output"},
+	{"Alt-PgUp, Alt-PgDn", "scroll the stderr pane"},
+	{"Shift-Left/Right", "scroll sideways while lines are not wrapped"},
+	{"n, N", "next or previous match while viewing find results"},
+	{"/", "find again while viewing find results"},
+	{"Ctrl-T", "toggle case sensitivity while finding"},
+	{"Ctrl-V", "invert the match while filtering"},
+	{"Up, Down, y", "extend the selection and copy it while selecting"},
+	{"j, k, g, G", "scroll the output while it has the focus"},
+	{"Ctrl-D", "end the input while typing it"},
+	{"Delete", "delete the selected snippet"},
+	{"Up, Down", "move through the matches while fuzzy-finding"},
+	{"Esc", "close the search, find, filter, selection, snippets, picker, help or explanation"},
+}
+
+var defaultBindings = map[action][]string{
+	actionQuit:              {"Ctrl-C"},
+	actionAbort:             {"Ctrl-Q"},
+	actionRun:               {"Enter"},
+	actionHistoryPrev:       {"Up", "Ctrl-P"},
+	actionHistoryNext:       {"Down", "Ctrl-N"},
+	actionHistorySearch:     {"Ctrl-R"},
+	actionFind:              {"Ctrl-S"},
+	actionFilter:            {"Alt-f"},
+	actionToggleAutoRun:     {"Ctrl-T"},
+	actionToggleWrap:        {"Alt-w"},
+	actionToggleMultiline:   {"Alt-e"},
+	actionCycleCount:        {"Alt-c"},
+	actionToggleSplit:       {"Alt-s"},
+	actionToggleBinary:      {"Alt-b"},
+	actionToggleJSON:        {"Alt-j"},
+	actionToggleTable:       {"Alt-t"},
+	actionToggleDiff:        {"Alt-d"},
+	actionToggleFreeze:      {"Alt-z"},
+	actionToggleLineNumbers: {"Alt-n"},
+	actionCursorLeft:        {"Ctrl-B"},
+	actionCursorRight:       {"Ctrl-F"},
+	actionDeleteChar:        {"Ctrl-D"},
+	actionComplete:          {"Tab"},
+	actionKill:              {"Ctrl-K"},
+	actionClear:             {"Ctrl-L"},
+	actionCopyCommand:       {"Ctrl-Y"},
+	actionCopyOutput:        {"Ctrl-O"},
+	actionSelect:            {"Ctrl-Space"},
+	actionFocus:             {"Alt-o"},
+	actionStdin:             {"Alt-i"},
+	actionPager:             {"Ctrl-V"},
+	actionSaveSnippet:       {"Ctrl-G"},
+	actionPickSnippet:       {"Ctrl-X"},
+	actionPickHistory:       {"Alt-r"},
+	actionExplain:           {"F2"},
+	actionHelp:              {"F1"},
+}
+
+type keyCode struct {
+	key  tcell.Key
+	ch   rune
+	mods tcell.ModMask
+}
+
+func eventKey(event *tcell.EventKey) keyCode {
+	k := keyCode{key: event.Key(), mods: event.Modifiers() & tcell.ModAlt}
+	if k.key == tcell.KeyRune {
+		k.ch = event.Rune()
+	}
+	return k
+}
+
+func parseKey(s string) (keyCode, error) {
+	var k keyCode
+	name := s
+	if len(name) > 4 && strings.EqualFold(name[:4], "alt-") {
+		k.mods = tcell.ModAlt
+		name = name[4:]
+	}
+
+	if utf8.RuneCountInString(name) == 1 {
+		k.key = tcell.KeyRune
+		k.ch, _ = utf8.DecodeRuneInString(name)
+		return k, nil
+	}
+
+	for key, n := range tcell.KeyNames {
+		if strings.EqualFold(n, name) {
+			k.key = key
+			return k, nil
+		}
+	}
+	return k, fmt.Errorf("unknown key: %q", s)
+}
+
+// Keymap maps keys to the actions they trigger.
+type Keymap map[keyCode]action
+
+// NewKeymap returns the default keymap with the keys of each action named in
+// bindings replaced, e.g. {"history-prev": {"Alt-p"}}. It fails when an
+// action or key is unknown or a key is bound to more than one action.
+func NewKeymap(bindings map[string][]string) (Keymap, error) {
+	keys := make(map[action][]string, len(defaultBindings))
+	for act, names := range defaultBindings {
+		keys[act] = names
+	}
+
+	for name, names := range bindings {
+		act := actionNone
+		for i, n := range actionNames {
+			if n != "" && n == name {
+				act = action(i)
+			}
+		}
+		if act == actionNone {
+			return nil, fmt.Errorf("unknown action: %q", name)
+		}
+		keys[act] = names
+	}
+
+	km := make(Keymap)
+	for i := range actionNames {
+		act := action(i)
+		for _, name := range keys[act] {
+			k, err := parseKey(name)
+			if err != nil {
+				return nil, err
+			}
+			if prev, ok := km[k]; ok {
+				return nil, fmt.Errorf("key %s is bound to both %s and %s", name, actionNames[prev], actionNames[act])
+			}
+			km[k] = act
+		}
+	}
+	return km, nil
+}
+
+func (k keyCode) String() string {
+	name := tcell.KeyNames[k.key]
+	if k.key == tcell.KeyRune {
+		name = string(k.ch)
+	}
+	if k.mods&tcell.ModAlt != 0 {
+		name = "Alt-" + name
+	}
+	return name
+}
+
+func (km Keymap) help() string {
+	names := make([][]string, len(actionNames))
+	for k, act := range km {
+		names[act] = append(names[act], k.String())
+	}
+
+	var b strings.Builder
+	for i := range actionNames {
+		if len(names[i]) == 0 {
+			continue
+		}
+		sort.Strings(names[i])
+		fmt.Fprintf(&b, "%-20s %s\n", strings.Join(names[i], ", "), actionHelps[i])
+	}
+	for _, h := range fixedHelps {
+		fmt.Fprintf(&b, "%-20s %s\n", h[0], h[1])
+	}
+	return b.String()
+}
+
+func (km Keymap) lookup(event *tcell.EventKey) action {
+	return km[eventKey(event)]
+}
@@ -0,0 +1,376 @@
+package plumb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+func (a *App) drain(r io.ReadCloser, w io.Writer, stderr bool) {
+	defer a.drains.Done()
+	defer r.Close()
+
+	b := make([]byte, a.cfg.BufferSize)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			a.write(w, b[0:n], stderr)
+		}
+		if err != nil {
+			if !stderr {
+				a.closeDumper()
+			}
+			a.mu.Lock()
+			a.drained++
+			a.dirty = true
+			a.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (a *App) write(w io.Writer, p []byte, stderr bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !stderr && !a.sniffed {
+		a.sniffed = true
+		if !a.showBinary && isBinary(p) {
+			fmt.Fprintf(&a.pending, "[::d]binary output detected, press Alt-B to show it as text[::-]\n\n")
+			a.dumper = hex.Dumper(escapeWriter{&a.pending})
+		}
+	}
+
+	switch {
+	case !stderr && a.dumper != nil:
+		a.dumper.Write(p)
+	case stderr && !a.split:
+		str := tview.Escape(ansiPattern.ReplaceAllString(sanitize(p), ""))
+		fmt.Fprintf(&a.pending, "[%s]%s[-]", a.cfg.StderrColor, str)
+	default:
+		io.WriteString(w, a.display(p))
+	}
+	a.dirty = true
+
+	// Split stderr has a pane of its own, so keep it out of the output that
+	// the main pane and the export are rebuilt from.
+	if stderr && a.split {
+		return
+	}
+	if stderr {
+		a.markErr(len(p))
+	}
+	a.bu.Write(p)
+	a.stamp(p)
+	a.count.Write(p)
+}
+
+// span is a range of offsets into the output buffer.
+type span struct {
+	start, end int
+}
+
+// markErr records that the next n bytes written to the output buffer come
+// from stderr, and forgets the ranges the buffer has dropped. It is called
+// with a.mu held.
+func (a *App) markErr(n int) {
+	off := a.bu.Dropped() + a.bu.Len()
+	if k := len(a.errSpans); k > 0 && a.errSpans[k-1].end == off {
+		a.errSpans[k-1].end += n
+	} else {
+		a.errSpans = append(a.errSpans, span{off, off + n})
+	}
+
+	dropped := a.bu.Dropped()
+	for len(a.errSpans) > 0 && a.errSpans[0].end <= dropped {
+		a.errSpans = a.errSpans[1:]
+	}
+}
+
+// clipSpans returns the parts of spans within the n bytes from off, moved to
+// count from off.
+func clipSpans(spans []span, off, n int) []span {
+	var out []span
+	for _, s := range spans {
+		start, end := s.start-off, s.end-off
+		if end <= 0 || start >= n {
+			continue
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end > n {
+			end = n
+		}
+		out = append(out, span{start, end})
+	}
+	return out
+}
+
+// colorErr formats p with the bytes in errs, which came from stderr, drawn in
+// the stderr color like they are while the output streams in.
+func (a *App) colorErr(p []byte, errs []span, format func([]byte) string) string {
+	if len(errs) == 0 {
+		return format(p)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, s := range errs {
+		b.WriteString(format(p[last:s.start]))
+		str := tview.Escape(ansiPattern.ReplaceAllString(sanitize(p[s.start:s.end]), ""))
+		fmt.Fprintf(&b, "[%s]%s[-]", a.cfg.StderrColor, str)
+		last = s.end
+	}
+	b.WriteString(format(p[last:]))
+	return b.String()
+}
+
+func (a *App) closeDumper() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.dumper != nil {
+		a.dumper.Close()
+		a.dirty = true
+	}
+}
+
+func isBinary(p []byte) bool {
+	if len(p) > 8000 {
+		p = p[:8000]
+	}
+	return bytes.IndexByte(p, 0) >= 0
+}
+
+func (a *App) display(p []byte) string {
+	text := sanitize(p)
+	if a.cfg.NoColor {
+		text = ansiPattern.ReplaceAllString(text, "")
+	}
+	return tview.Escape(text)
+}
+
+// formatLines formats the lines of p that pass the filter, prefixed with
+// their numbers counting from first when line numbers are shown and with the
+// times in stamps, one for each line of p, when there are any. The bytes of p
+// in errs came from stderr.
+func (a *App) formatLines(p []byte, first int, stamps []time.Time, errs []span, format func([]byte) string) string {
+	if a.filter == nil && !a.lineNumbers && len(stamps) == 0 {
+		return a.colorErr(p, errs, format)
+	}
+
+	var b strings.Builder
+	off := 0
+	for i, line := range bytes.SplitAfter(p, []byte("\n")) {
+		off += len(line)
+		if !a.keepLine(line) {
+			continue
+		}
+		if a.lineNumbers {
+			fmt.Fprintf(&b, "[%s]%6d[-]  ", colorTag(a.cfg.Theme.Status), first+i)
+		}
+		if i < len(stamps) && !stamps[i].IsZero() {
+			fmt.Fprintf(&b, "[%s]%s[-] ", colorTag(a.cfg.Theme.Status), stamps[i].Format(timestampFormat))
+		}
+		b.WriteString(a.colorErr(line, clipSpans(errs, off-len(line), len(line)), format))
+	}
+	return b.String()
+}
+
+func sanitize(p []byte) string {
+	b := make([]byte, len(p))
+	for i, c := range p {
+		switch {
+		case c == '\t' || c == '\n' || c == '\r' || c == '\x1b':
+			b[i] = c
+		case c < 0x20 || c == 0x7f:
+			b[i] = '.'
+		default:
+			b[i] = c
+		}
+	}
+	return string(b)
+}
+
+type escapeWriter struct {
+	w io.Writer
+}
+
+func (e escapeWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(e.w, tview.Escape(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stripWriter strips ANSI sequences from what it writes, holding back a
+// sequence split across writes until the rest of it arrives.
+type stripWriter struct {
+	w    io.Writer
+	held []byte
+}
+
+func (s *stripWriter) Write(p []byte) (int, error) {
+	b := append(s.held, p...)
+	s.held = nil
+	if loc := partialEscape.FindIndex(b); loc != nil {
+		s.held = append([]byte(nil), b[loc[0]:]...)
+		b = b[:loc[0]]
+	}
+	if _, err := s.w.Write(ansiPattern.ReplaceAll(b, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes what is held back, which the output ended before finishing.
+func (s *stripWriter) Flush() error {
+	_, err := s.w.Write(s.held)
+	s.held = nil
+	return err
+}
+
+func (a *App) refresh() {
+	ticker := time.NewTicker(time.Second / time.Duration(a.cfg.FPS))
+	defer ticker.Stop()
+
+	var spin <-chan time.Time
+	if !a.cfg.LowPower {
+		spinner := time.NewTicker(spinInterval)
+		defer spinner.Stop()
+		spin = spinner.C
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			dirty := a.dirty
+			a.mu.Unlock()
+
+			if dirty {
+				a.ui.QueueUpdateDraw(a.flush)
+			}
+		case <-spin:
+			a.mu.Lock()
+			running := a.running
+			a.mu.Unlock()
+
+			if running {
+				a.ui.QueueUpdateDraw(a.stepSpinner)
+			}
+		}
+	}
+}
+
+func (a *App) flush() {
+	if a.selecting {
+		return
+	}
+	if a.table || a.diff {
+		a.mu.Lock()
+		a.ui.ErrView.Write(a.pendingErr.Bytes())
+		a.pendingErr.Reset()
+		a.dirty = false
+		a.mu.Unlock()
+		a.render()
+		a.updateSize()
+		return
+	}
+	if a.perLine() {
+		a.appendLines()
+		a.updateSize()
+		return
+	}
+
+	a.mu.Lock()
+	a.ui.MainView.Write(a.pending.Bytes())
+	a.ui.ErrView.Write(a.pendingErr.Bytes())
+	a.pending.Reset()
+	a.pendingErr.Reset()
+	a.dirty = false
+
+	keep := a.keep
+	if keep.row+keep.col > 0 && a.count.Lines >= keep.lines {
+		a.keep = scrollPos{}
+		a.ui.MainView.ScrollTo(keep.row, keep.col)
+	}
+	a.mu.Unlock()
+
+	a.updateSize()
+}
+
+// perLine reports whether the lines of the output are formatted one by one
+// for the filter, the line numbers or the timestamps.
+func (a *App) perLine() bool {
+	return a.filter != nil || a.lineNumbers || a.cfg.Timestamps
+}
+
+// snapshot drops the pending output and returns the buffered output, the
+// number of its first line and the ranges of it from stderr, marking it as
+// shown. While the lines are
+// formatted one by one and the command is still writing, a partial last line
+// is left for appendLines.
+func (a *App) snapshot() ([]byte, int, []span) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending.Reset()
+	b := a.bu.Bytes()
+	first := a.count.Lines - countLines(b) + 1
+	if a.perLine() && a.drained < 2 {
+		b = b[:bytes.LastIndexByte(b, '\n')+1]
+	}
+	a.shown = a.bu.Dropped() + len(b)
+	a.shownLine = first + countLines(b)
+	return b, first, clipSpans(a.errSpans, a.bu.Dropped(), len(b))
+}
+
+// appendLines formats the lines buffered since they were last shown and adds
+// them to the view, so that new output costs only its own lines. A partial
+// last line waits for the rest of it until the command stops writing.
+func (a *App) appendLines() {
+	a.mu.Lock()
+	if dropped := a.bu.Dropped(); a.shown < dropped {
+		a.shown = dropped
+		a.shownLine = a.bu.DroppedLines() + 1
+	}
+	p := make([]byte, a.bu.Dropped()+a.bu.Len()-a.shown)
+	n, _ := a.bu.readAt(p, a.shown)
+	p = p[:n]
+	if a.drained < 2 {
+		p = p[:bytes.LastIndexByte(p, '\n')+1]
+	}
+	first := a.shownLine
+	errs := clipSpans(a.errSpans, a.shown, len(p))
+	a.shown += len(p)
+	a.shownLine += countLines(p)
+	stamps := a.stampsFor(first, countLines(p)+1)
+
+	a.ui.ErrView.Write(a.pendingErr.Bytes())
+	a.pending.Reset()
+	a.pendingErr.Reset()
+	a.dirty = false
+	a.mu.Unlock()
+
+	if len(p) > 0 {
+		io.WriteString(tview.ANSIWriter(a.ui.MainView), a.formatLines(p, first, stamps, errs, a.display))
+	}
+}
+
+// discard drops the output not yet shown in the main view, and in the stderr
+// pane too with errs.
+func (a *App) discard(errs bool) {
+	a.mu.Lock()
+	a.pending.Reset()
+	if errs {
+		a.pendingErr.Reset()
+	}
+	a.mu.Unlock()
+}
@@ -0,0 +1,183 @@
+package plumb
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// newTestApp returns an App drawing to a simulation screen, with its history
+// and snippets kept in a temporary directory. The App is not run.
+func newTestApp(t *testing.T, cfg Config) (*App, tcell.SimulationScreen) {
+	sim := tcell.NewSimulationScreen("UTF-8")
+	if err := sim.Init(); err != nil {
+		t.Fatal(err)
+	}
+	sim.SetSize(80, 24)
+
+	dir := t.TempDir()
+	cfg.Screen = sim
+	cfg.HistoryFile = filepath.Join(dir, "history")
+	cfg.SnippetsFile = filepath.Join(dir, "snippets")
+	if cfg.Input == nil {
+		cfg.Input = strings.NewReader("")
+	}
+	return New(cfg), sim
+}
+
+// drainLines starts draining n numbered lines written to stdout and to
+// stderr the way Start does, and returns the lines written to each.
+func drainLines(a *App, n int) (string, string) {
+	var want [2]strings.Builder
+	a.drains.Add(2)
+	for i, name := range []string{"out", "err"} {
+		r, w := io.Pipe()
+		buf := &a.pending
+		if i == 1 {
+			buf = &a.pendingErr
+		}
+		for k := 0; k < n; k++ {
+			fmt.Fprintf(&want[i], "%s %d\n", name, k)
+		}
+		go a.drain(r, buf, i == 1)
+		go func(text string) {
+			for _, line := range strings.SplitAfter(text, "\n") {
+				io.WriteString(w, line)
+			}
+			w.Close()
+		}(want[i].String())
+	}
+	return want[0].String(), want[1].String()
+}
+
+// grepLines returns the lines of text starting with prefix.
+func grepLines(text, prefix string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+func TestDrainRace(t *testing.T) {
+	a, _ := newTestApp(t, Config{Split: true})
+	out, errs := drainLines(a, 2000)
+
+	done := make(chan struct{})
+	go func() {
+		a.drains.Wait()
+		close(done)
+	}()
+
+	for i := 0; !isClosed(done); i++ {
+		if i%10 == 0 {
+			a.lineNumbers = !a.lineNumbers
+			a.render()
+		}
+		a.flush()
+	}
+
+	a.lineNumbers = false
+	a.render()
+	a.flush()
+	if got := a.bu.String(); got != out {
+		t.Errorf("buffered %d bytes, want %d of stdout", len(got), len(out))
+	}
+	if got := a.ui.MainView.GetText(true); got != out {
+		t.Errorf("shown %d bytes, want %d of stdout", len(got), len(out))
+	}
+	if got := a.ui.ErrView.GetText(true); got != errs {
+		t.Errorf("shown %d bytes of stderr, want %d", len(got), len(errs))
+	}
+	if got := string(a.exported()); got != out {
+		t.Errorf("exported %d bytes, want %d of stdout", len(got), len(out))
+	}
+}
+
+func TestFlushTimestamps(t *testing.T) {
+	a, _ := newTestApp(t, Config{Split: true, Timestamps: true})
+	out, errs := drainLines(a, 2000)
+
+	done := make(chan struct{})
+	go func() {
+		a.drains.Wait()
+		close(done)
+	}()
+	for !isClosed(done) {
+		a.flush()
+		time.Sleep(time.Millisecond)
+	}
+	a.flush()
+
+	stamp := regexp.MustCompile(`(?m)^\d\d:\d\d:\d\d\.\d{3} `)
+	if got := grepLines(stamp.ReplaceAllString(a.ui.MainView.GetText(true), ""), "out "); got != out {
+		t.Errorf("shown %d bytes of stdout, want %d", len(got), len(out))
+	}
+	if got := a.ui.ErrView.GetText(true); got != errs {
+		t.Errorf("shown %d bytes of stderr, want %d", len(got), len(errs))
+	}
+}
+
+func TestStampsTrimmed(t *testing.T) {
+	a, _ := newTestApp(t, Config{Timestamps: true, ExportTimestamps: true, MaxBuffer: 1 << 10})
+	for i := 0; i < 10000; i++ {
+		a.write(&a.pending, []byte(fmt.Sprintf("line %d\n", i)), false)
+	}
+
+	if n, max := len(a.stamps), countLines(a.bu.Bytes())+1; n > max {
+		t.Errorf("kept %d stamps for %d buffered lines", n, max)
+	}
+	lines := strings.SplitAfter(string(a.exported()), "\n")
+	if last := lines[len(lines)-2]; !regexp.MustCompile(`^\d\d:\d\d:\d\d\.\d{3} line 9999\n$`).MatchString(last) {
+		t.Errorf("exported last line %q", last)
+	}
+}
+
+func TestStderrColorRerender(t *testing.T) {
+	a, _ := newTestApp(t, Config{StderrColor: "red"})
+	a.write(&a.pending, []byte("out 0\n"), false)
+	a.write(&a.pending, []byte("err 0\nerr 1\n"), true)
+	a.write(&a.pending, []byte("out 1\n"), false)
+
+	for _, numbers := range []bool{false, true} {
+		a.lineNumbers = numbers
+		a.render()
+		text := a.ui.MainView.GetText(false)
+		var colored strings.Builder
+		for _, m := range regexp.MustCompile(`(?s)\[red\](.*?)\[-\]`).FindAllStringSubmatch(text, -1) {
+			colored.WriteString(m[1])
+		}
+		if got, want := colored.String(), "err 0\nerr 1\n"; got != want {
+			t.Errorf("line numbers %v: shown %q, colored %q, want %q", numbers, text, got, want)
+		}
+	}
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestStripWriter(t *testing.T) {
+	var b strings.Builder
+	s := &stripWriter{w: &b}
+	for _, w := range []string{"a\x1b[3", "1mb\x1b", "[0m\n\x1b["} {
+		s.Write([]byte(w))
+	}
+	s.Flush()
+	if got, want := b.String(), "ab\n\x1b["; got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
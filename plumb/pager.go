@@ -0,0 +1,24 @@
+package plumb
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const defaultPager = "less -R"
+
+func runPager(p []byte) error {
+	pager := os.Getenv("PAGER")
+	if strings.TrimSpace(pager) == "" {
+		pager = defaultPager
+	}
+
+	args := strings.Fields(pager)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(p)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
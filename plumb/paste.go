@@ -0,0 +1,38 @@
+package plumb
+
+import (
+	"github.com/gdamore/tcell/v2"
+)
+
+// pasteScreen passes the keys of a bracketed paste on as plain runes, and
+// line breaks and tabs as Enter and Tab marked with ModMeta, so that pasted
+// text can be typed instead of triggering the key bindings.
+type pasteScreen struct {
+	tcell.Screen
+	pasting bool
+}
+
+func (s *pasteScreen) PollEvent() tcell.Event {
+	for {
+		ev := s.Screen.PollEvent()
+		switch e := ev.(type) {
+		case *tcell.EventPaste:
+			s.pasting = e.Start()
+			continue
+		case *tcell.EventKey:
+			if !s.pasting {
+				return ev
+			}
+			switch e.Key() {
+			case tcell.KeyRune:
+				return tcell.NewEventKey(tcell.KeyRune, e.Rune(), tcell.ModNone)
+			case tcell.KeyEnter, tcell.KeyLF:
+				return tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModMeta)
+			case tcell.KeyTab:
+				return tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModMeta)
+			}
+			continue
+		}
+		return ev
+	}
+}
@@ -0,0 +1,178 @@
+package plumb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// maxPicks bounds the matches listed by the fuzzy picker.
+const maxPicks = 1000
+
+type pickItem struct {
+	text  string
+	label string
+}
+
+// fuzzyMatch reports whether the runes of query appear in text in order and
+// returns a score, higher for matches that are consecutive, start a word or
+// are close together, with the positions of the runes matched. It ignores
+// case unless query has an upper case letter.
+func fuzzyMatch(text, query []rune) (int, []int, bool) {
+	if len(query) == 0 {
+		return 0, nil, true
+	}
+	fold := true
+	for _, r := range query {
+		if unicode.IsUpper(r) {
+			fold = false
+		}
+	}
+	eq := func(a, b rune) bool {
+		if fold {
+			a = unicode.ToLower(a)
+		}
+		return a == b
+	}
+
+	// Find the first place query ends, then walk back from there to the
+	// shortest match ending at it.
+	end, j := -1, 0
+	for i := 0; i < len(text) && j < len(query); i++ {
+		if eq(text[i], query[j]) {
+			j++
+			end = i
+		}
+	}
+	if j < len(query) {
+		return 0, nil, false
+	}
+
+	pos := make([]int, len(query))
+	j = len(query) - 1
+	for i := end; j >= 0; i-- {
+		if eq(text[i], query[j]) {
+			pos[j] = i
+			j--
+		}
+	}
+
+	score := 0
+	for k, i := range pos {
+		score += 16
+		if i == 0 || strings.ContainsRune(" /-_.|=:", text[i-1]) {
+			score += 8
+		}
+		if k > 0 {
+			if i == pos[k-1]+1 {
+				score += 8
+			} else {
+				score -= i - pos[k-1] - 1
+			}
+		}
+	}
+	return score - pos[0]/4, pos, true
+}
+
+// startPick opens the fuzzy picker over the history, newest first, and the
+// snippets.
+func (a *App) startPick() {
+	a.pickItems = a.pickItems[:0]
+	seen := make(map[string]bool)
+	for i := len(a.hi.Lines) - 1; i >= 0; i-- {
+		text := a.hi.Lines[i]
+		if text == "" || seen[text] {
+			continue
+		}
+		seen[text] = true
+		a.pickItems = append(a.pickItems, pickItem{text: text, label: text})
+	}
+	for _, name := range a.sn.Names {
+		text := a.sn.Commands[name]
+		a.pickItems = append(a.pickItems, pickItem{text: text, label: name + ": " + text})
+	}
+	if len(a.pickItems) == 0 {
+		a.notify("no history", a.cfg.Theme.Status)
+		return
+	}
+
+	a.ui.PickerInput.SetText("")
+	a.narrowPick()
+	a.ui.ShowPicker()
+}
+
+// narrowPick lists the items matching the text typed, best first.
+func (a *App) narrowPick() {
+	query := []rune(a.ui.PickerInput.GetText())
+	type match struct {
+		item, score int
+		pos         []int
+	}
+	var matches []match
+	for i, it := range a.pickItems {
+		if score, pos, ok := fuzzyMatch([]rune(it.label), query); ok {
+			matches = append(matches, match{i, score, pos})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	if len(matches) > maxPicks {
+		matches = matches[:maxPicks]
+	}
+
+	a.picked = a.picked[:0]
+	a.ui.PickerList.Clear()
+	for _, m := range matches {
+		a.picked = append(a.picked, m.item)
+		a.ui.PickerList.AddItem(a.markPick(a.pickItems[m.item].label, m.pos), "", 0, nil)
+	}
+	a.ui.picker.SetTitle(fmt.Sprintf(" history %d/%d ", len(matches), len(a.pickItems)))
+}
+
+// markPick highlights the runes of label at pos, showing newlines as spaces.
+func (a *App) markPick(label string, pos []int) string {
+	runes := []rune(strings.Replace(label, "\n", " ", -1))
+	var b strings.Builder
+	start := 0
+	for k := 0; k < len(pos); {
+		end := k + 1
+		for end < len(pos) && pos[end] == pos[end-1]+1 {
+			end++
+		}
+		b.WriteString(tview.Escape(string(runes[start:pos[k]])))
+		b.WriteString(a.matchTag + tview.Escape(string(runes[pos[k]:pos[end-1]+1])) + "[-:-:-]")
+		start = pos[end-1] + 1
+		k = end
+	}
+	b.WriteString(tview.Escape(string(runes[start:])))
+	return b.String()
+}
+
+func (a *App) handlePick(event *tcell.EventKey) *tcell.EventKey {
+	list := a.ui.PickerList
+	switch event.Key() {
+	case tcell.KeyUp, tcell.KeyCtrlP:
+		if i := list.GetCurrentItem(); i > 0 {
+			list.SetCurrentItem(i - 1)
+		}
+	case tcell.KeyDown, tcell.KeyCtrlN:
+		if i := list.GetCurrentItem(); i < list.GetItemCount()-1 {
+			list.SetCurrentItem(i + 1)
+		}
+	case tcell.KeyPgUp, tcell.KeyPgDn:
+		list.InputHandler()(event, nil)
+	case tcell.KeyEnter:
+		a.ui.HidePicker()
+		if len(a.picked) > 0 {
+			a.setInputText(a.pickItems[a.picked[list.GetCurrentItem()]].text)
+		}
+	case tcell.KeyEscape:
+		a.ui.HidePicker()
+	default:
+		return event
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package plumb
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// startSelect shows the output as plain lines and moves the focus there to
+// select a range of them, starting with the top line on screen.
+func (a *App) startSelect() {
+	p, _ := a.visible()
+	text := ansiPattern.ReplaceAllString(sanitize(a.filterLines(p)), "")
+	if text == "" {
+		a.notify("no output", a.cfg.Theme.Warning)
+		return
+	}
+	a.selLines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	row, _ := a.ui.MainView.GetScrollOffset()
+	if row >= len(a.selLines) {
+		row = len(a.selLines) - 1
+	}
+
+	a.discard(false)
+	a.selecting = true
+	a.selMark, a.selPos = row, row
+	a.ui.SetFocus(a.ui.MainView)
+	a.updateSelect()
+}
+
+func (a *App) stopSelect() {
+	a.selecting = false
+	a.selLines = nil
+	a.ui.MainView.Highlight()
+	a.render()
+	a.ui.SetFocus(a.ui.Editor())
+	a.updateMode()
+}
+
+// moveSelect moves the end of the selection by step lines.
+func (a *App) moveSelect(step int) {
+	a.selPos += step
+	if a.selPos < 0 {
+		a.selPos = 0
+	}
+	if a.selPos >= len(a.selLines) {
+		a.selPos = len(a.selLines) - 1
+	}
+	a.updateSelect()
+}
+
+// updateSelect colors the selected lines and keeps the moving end of the
+// selection, highlighted as a region, on screen.
+func (a *App) updateSelect() {
+	from, to := a.selRange()
+
+	var b strings.Builder
+	for i, line := range a.selLines {
+		line = tview.Escape(line)
+		if i >= from && i < to {
+			line = a.matchTag + line + "[-:-:-]"
+		}
+		if i == a.selPos {
+			line = `["sel"]` + line + `[""]`
+		}
+		b.WriteString(line + "\n")
+	}
+
+	a.ui.MainView.SetText(b.String())
+	a.ui.MainView.Highlight("sel").ScrollToHighlight()
+	a.updateMode()
+}
+
+func (a *App) selRange() (int, int) {
+	if a.selMark <= a.selPos {
+		return a.selMark, a.selPos + 1
+	}
+	return a.selPos, a.selMark + 1
+}
+
+// selected returns the selected lines.
+func (a *App) selected() string {
+	from, to := a.selRange()
+	return strings.Join(a.selLines[from:to], "\n") + "\n"
+}
+
+func (a *App) handleSelect(event *tcell.EventKey) *tcell.EventKey {
+	_, _, _, height := a.ui.MainView.GetInnerRect()
+	switch event.Key() {
+	case tcell.KeyEscape:
+		a.stopSelect()
+	case tcell.KeyEnter:
+		a.copy(a.selected())
+		a.stopSelect()
+	case tcell.KeyUp:
+		a.moveSelect(-1)
+	case tcell.KeyDown:
+		a.moveSelect(1)
+	case tcell.KeyPgUp:
+		a.moveSelect(-height)
+	case tcell.KeyPgDn:
+		a.moveSelect(height)
+	case tcell.KeyHome:
+		a.moveSelect(-len(a.selLines))
+	case tcell.KeyEnd:
+		a.moveSelect(len(a.selLines))
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'k':
+			a.moveSelect(-1)
+		case 'j':
+			a.moveSelect(1)
+		case 'g':
+			a.moveSelect(-len(a.selLines))
+		case 'G':
+			a.moveSelect(len(a.selLines))
+		case 'y':
+			a.copy(a.selected())
+			a.stopSelect()
+		}
+	default:
+		if a.cfg.Keys.lookup(event) == actionSelect {
+			a.selMark = a.selPos
+			a.updateSelect()
+		}
+	}
+	return nil
+}
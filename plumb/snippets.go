@@ -0,0 +1,93 @@
+package plumb
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type snippets struct {
+	path     string
+	Names    []string
+	Commands map[string]string
+}
+
+func getSnippetsPath() string {
+	if path := os.Getenv("GOPLUMB_SNIPPETS"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".goplumb_snippets")
+}
+
+func newSnippets(path string) *snippets {
+	s := &snippets{path: path, Commands: make(map[string]string)}
+	if path == "" {
+		return s
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return s
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		i := strings.IndexByte(sc.Text(), '\t')
+		if i <= 0 {
+			continue
+		}
+		s.Commands[sc.Text()[:i]] = sc.Text()[i+1:]
+	}
+
+	s.sort()
+	return s
+}
+
+func (s *snippets) Set(name, command string) error {
+	name = strings.Join(strings.Fields(name), " ")
+	s.Commands[name] = joinLines(command)
+	s.sort()
+	return s.save()
+}
+
+func (s *snippets) Delete(name string) error {
+	delete(s.Commands, name)
+	s.sort()
+	return s.save()
+}
+
+func (s *snippets) sort() {
+	s.Names = s.Names[:0]
+	for name := range s.Commands {
+		s.Names = append(s.Names, name)
+	}
+	sort.Strings(s.Names)
+}
+
+func (s *snippets) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, name := range s.Names {
+		if _, err := fmt.Fprintf(f, "%s\t%s\n", name, s.Commands[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
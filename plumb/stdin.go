@@ -0,0 +1,49 @@
+package plumb
+
+import (
+	"io"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// startStdin shows the line typed into as the input of the command and moves
+// the focus there.
+func (a *App) startStdin() {
+	if a.stdin == nil {
+		msg := "no stdin"
+		if a.cfg.InteractiveInput {
+			msg = "input closed"
+		}
+		a.notify(msg, a.cfg.Theme.Warning)
+		return
+	}
+	a.ui.layout.RemoveItem(a.ui.StdinInput)
+	a.ui.layout.AddItem(a.ui.StdinInput, 1, 0, true)
+	a.ui.SetFocus(a.ui.StdinInput)
+}
+
+// closeStdin sends what is typed without a newline and ends the input.
+func (a *App) closeStdin() {
+	io.WriteString(a.stdin, a.ui.StdinInput.GetText())
+	a.stdin.Close()
+	a.stdin = nil
+
+	a.ui.layout.RemoveItem(a.ui.StdinInput)
+	a.ui.StdinInput.SetText("")
+	a.ui.SetFocus(a.ui.Editor())
+}
+
+func (a *App) handleStdin(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEnter:
+		io.WriteString(a.stdin, a.ui.StdinInput.GetText()+"\n")
+		a.ui.StdinInput.SetText("")
+	case tcell.KeyEscape:
+		a.ui.SetFocus(a.ui.Editor())
+	case tcell.KeyCtrlD:
+		a.closeStdin()
+	default:
+		return event
+	}
+	return nil
+}
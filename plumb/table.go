@@ -0,0 +1,52 @@
+package plumb
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// alignColumns pads the columns of p, split at delim, so that they line up
+// like column -t. An empty delim splits at tabs when p has any and at runs of
+// spaces otherwise. ANSI sequences are dropped.
+func alignColumns(p []byte, delim string) []byte {
+	p = ansiPattern.ReplaceAll(p, nil)
+	if delim == "" && bytes.IndexByte(p, '\t') >= 0 {
+		delim = "\t"
+	}
+
+	lines := bytes.SplitAfter(p, []byte("\n"))
+	rows := make([][]string, len(lines))
+	var widths []int
+	for i, line := range lines {
+		text := strings.TrimRight(string(line), "\r\n")
+		if delim == "" {
+			rows[i] = strings.Fields(text)
+		} else {
+			rows[i] = strings.Split(text, delim)
+		}
+		for j, cell := range rows[i] {
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := tview.TaggedStringWidth(tview.Escape(cell)); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	for i, row := range rows {
+		for j, cell := range row {
+			b.WriteString(cell)
+			if j < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[j]-tview.TaggedStringWidth(tview.Escape(cell))+2))
+			}
+		}
+		if bytes.HasSuffix(lines[i], []byte("\n")) {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
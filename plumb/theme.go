@@ -0,0 +1,107 @@
+package plumb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Theme holds the colors of the editor.
+type Theme struct {
+	Background  tcell.Color
+	Foreground  tcell.Color
+	Label       tcell.Color
+	Placeholder tcell.Color
+	Status      tcell.Color
+	Success     tcell.Color
+	Failure     tcell.Color
+	Warning     tcell.Color
+	Stderr      tcell.Color
+	MatchFg     tcell.Color
+	MatchBg     tcell.Color
+}
+
+var themes = map[string]Theme{
+	"dark": {
+		Background:  tcell.Color235,
+		Foreground:  tcell.ColorWhite,
+		Label:       tcell.ColorForestGreen,
+		Placeholder: tcell.ColorDarkGray,
+		Status:      tcell.ColorDarkGray,
+		Success:     tcell.ColorForestGreen,
+		Failure:     tcell.ColorRed,
+		Warning:     tcell.ColorDarkOrange,
+		Stderr:      tcell.ColorRed,
+		MatchFg:     tcell.ColorBlack,
+		MatchBg:     tcell.ColorYellow,
+	},
+	"light": {
+		Background:  tcell.Color255,
+		Foreground:  tcell.ColorBlack,
+		Label:       tcell.ColorDarkGreen,
+		Placeholder: tcell.ColorGray,
+		Status:      tcell.ColorGray,
+		Success:     tcell.ColorDarkGreen,
+		Failure:     tcell.ColorDarkRed,
+		Warning:     tcell.ColorDarkOrange,
+		Stderr:      tcell.ColorDarkRed,
+		MatchFg:     tcell.ColorBlack,
+		MatchBg:     tcell.ColorGold,
+	},
+}
+
+// ThemeNames returns the names of the built-in themes.
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupTheme returns the built-in theme called name.
+func LookupTheme(name string) (Theme, error) {
+	t, ok := themes[name]
+	if !ok {
+		return t, fmt.Errorf("unknown theme: %q (choose from %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+	return t, nil
+}
+
+// SetColor sets the color of the theme field called name, e.g. "background".
+func (t *Theme) SetColor(name, value string) error {
+	c := tcell.GetColor(value)
+	if c == tcell.ColorDefault && value != "default" {
+		return fmt.Errorf("invalid color: %q", value)
+	}
+
+	fields := map[string]*tcell.Color{
+		"background":  &t.Background,
+		"foreground":  &t.Foreground,
+		"label":       &t.Label,
+		"placeholder": &t.Placeholder,
+		"status":      &t.Status,
+		"success":     &t.Success,
+		"failure":     &t.Failure,
+		"warning":     &t.Warning,
+		"stderr":      &t.Stderr,
+		"match-fg":    &t.MatchFg,
+		"match-bg":    &t.MatchBg,
+	}
+	p, ok := fields[name]
+	if !ok {
+		return fmt.Errorf("unknown theme color: %q", name)
+	}
+	*p = c
+	return nil
+}
+
+func colorTag(c tcell.Color) string {
+	if c == tcell.ColorDefault {
+		return "-"
+	}
+	return fmt.Sprintf("#%06x", c.Hex())
+}
@@ -0,0 +1,81 @@
+package plumb
+
+import (
+	"bytes"
+	"time"
+)
+
+const timestampFormat = "15:04:05.000"
+
+// stamp records when each line starting in p arrived and forgets the lines
+// the output buffer has dropped. It is called with a.mu held for every chunk
+// written to the output buffer.
+func (a *App) stamp(p []byte) {
+	if !a.cfg.Timestamps || len(p) == 0 {
+		return
+	}
+
+	now := time.Now()
+	if !a.midLine {
+		a.stamps = append(a.stamps, now)
+	}
+	for _, c := range p[:len(p)-1] {
+		if c == '\n' {
+			a.stamps = append(a.stamps, now)
+		}
+	}
+	a.midLine = p[len(p)-1] != '\n'
+
+	if d := a.bu.DroppedLines() - a.stampBase; d > 0 {
+		if d > len(a.stamps) {
+			d = len(a.stamps)
+		}
+		a.stamps = a.stamps[d:]
+		a.stampBase += d
+	}
+}
+
+// stampsFor returns the times of the n lines from line number first, zero
+// for the lines without one. It is called with a.mu held.
+func (a *App) stampsFor(first, n int) []time.Time {
+	if len(a.stamps) == 0 {
+		return nil
+	}
+	stamps := make([]time.Time, n)
+	for i := range stamps {
+		if k := first + i - 1 - a.stampBase; k >= 0 && k < len(a.stamps) {
+			stamps[i] = a.stamps[k]
+		}
+	}
+	return stamps
+}
+
+func (a *App) lineStamps(first, n int) []time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.stampsFor(first, n)
+}
+
+// exported returns the output as printed or saved on exit, with the arrival
+// time of each line when ExportTimestamps is set.
+func (a *App) exported() []byte {
+	b, first := a.output()
+	if !a.cfg.Timestamps || !a.cfg.ExportTimestamps {
+		return b
+	}
+
+	stamps := a.lineStamps(first, countLines(b)+1)
+
+	var out bytes.Buffer
+	for i, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if i < len(stamps) && !stamps[i].IsZero() {
+			out.WriteString(stamps[i].Format(timestampFormat) + " ")
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,571 @@
+package plumb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	cmdAreaHeight  = 5
+	minEditorWidth = 20
+	sizeViewWidth  = 26
+)
+
+func getProgramName() string {
+	return filepath.Base(os.Args[0])
+}
+
+type tui struct {
+	*tview.Application
+	pages  *tview.Pages
+	layout *tview.Flex
+	footer *tview.Flex
+	body   *tview.Flex
+	panes  *tview.Flex
+	picker *tview.Flex
+	focus  tview.Primitive
+	screen tcell.Screen
+	mouse  bool
+	colors string
+
+	split     bool
+	multiline bool
+	frozen    bool
+	fallback  string
+	width     int
+	sizeWidth int
+
+	MainView    *tview.TextView
+	TruncView   *tview.TextView
+	ErrView     *tview.TextView
+	FrozenView  *tview.TextView
+	SizeView    *tview.TextView
+	ModeView    *tview.TextView
+	ExitView    *tview.TextView
+	TimeView    *tview.TextView
+	CmdInput    *tview.InputField
+	CmdArea     *tview.TextArea
+	SearchInput *tview.InputField
+	FindInput   *tview.InputField
+	FilterInput *tview.InputField
+	StdinInput  *tview.InputField
+	NameInput   *tview.InputField
+	HelpView    *tview.TextView
+	QuitView    *tview.TextView
+	ExplainView *tview.TextView
+	SnippetList *tview.List
+	PickerInput *tview.InputField
+	PickerList  *tview.List
+}
+
+func newTUI(t Theme, screen tcell.Screen, prompt, fallback string) *tui {
+	ui := &tui{Application: tview.NewApplication(), screen: screen, fallback: fallback}
+
+	ui.MainView = tview.NewTextView()
+	ui.MainView.
+		SetDynamicColors(true).
+		SetRegions(true).
+		SetTextColor(t.Foreground).
+		SetBackgroundColor(t.Background)
+
+	ui.TruncView = tview.NewTextView()
+	ui.TruncView.
+		SetTextColor(t.Warning).
+		SetBackgroundColor(t.Background)
+
+	ui.ErrView = tview.NewTextView()
+	ui.ErrView.
+		SetDynamicColors(true).
+		SetTextColor(t.Foreground).
+		SetBorder(true).
+		SetTitle(" stderr ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorderColor(t.Status).
+		SetTitleColor(t.Status).
+		SetBackgroundColor(t.Background)
+
+	ui.FrozenView = tview.NewTextView()
+	ui.FrozenView.
+		SetDynamicColors(true).
+		SetRegions(true).
+		SetTextColor(t.Foreground).
+		SetBorder(true).
+		SetTitleAlign(tview.AlignLeft).
+		SetBorderColor(t.Status).
+		SetTitleColor(t.Status).
+		SetBackgroundColor(t.Background)
+
+	ui.SizeView = tview.NewTextView()
+	ui.SizeView.
+		SetText(fmt.Sprint("0 bytes")).
+		SetTextAlign(tview.AlignRight).
+		SetTextColor(t.Status).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.ModeView = tview.NewTextView()
+	ui.ModeView.
+		SetTextAlign(tview.AlignRight).
+		SetTextColor(t.Status).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.ExitView = tview.NewTextView()
+	ui.ExitView.
+		SetTextAlign(tview.AlignRight).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.TimeView = tview.NewTextView()
+	ui.TimeView.
+		SetTextAlign(tview.AlignRight).
+		SetTextColor(t.Status).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.CmdInput = tview.NewInputField()
+	ui.CmdInput.
+		SetLabel(tview.Escape(prompt)).
+		SetLabelColor(t.Label).
+		SetPlaceholder(fallback).
+		SetPlaceholderTextColor(t.Placeholder).
+		SetFieldTextColor(t.Foreground).
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.CmdArea = tview.NewTextArea()
+	ui.CmdArea.
+		SetPlaceholder(fallback).
+		SetPlaceholderStyle(tcell.StyleDefault.Foreground(t.Placeholder)).
+		SetTextStyle(tcell.StyleDefault.Foreground(t.Foreground)).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.SearchInput = tview.NewInputField()
+	ui.SearchInput.
+		SetLabel("(reverse-i-search) ").
+		SetLabelColor(t.Status).
+		SetFieldTextColor(t.Foreground).
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.FindInput = tview.NewInputField()
+	ui.FindInput.
+		SetLabelColor(t.Status).
+		SetFieldTextColor(t.Foreground).
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.FilterInput = tview.NewInputField()
+	ui.FilterInput.
+		SetLabelColor(t.Status).
+		SetFieldTextColor(t.Foreground).
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.StdinInput = tview.NewInputField()
+	ui.StdinInput.
+		SetLabel("stdin: ").
+		SetLabelColor(t.Status).
+		SetFieldTextColor(t.Foreground).
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.NameInput = tview.NewInputField()
+	ui.NameInput.
+		SetLabel("snippet name: ").
+		SetLabelColor(t.Status).
+		SetFieldTextColor(t.Foreground).
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.SnippetList = tview.NewList()
+	ui.SnippetList.
+		SetMainTextColor(t.Foreground).
+		SetSecondaryTextColor(t.Status).
+		SetSelectedTextColor(t.MatchFg).
+		SetSelectedBackgroundColor(t.MatchBg).
+		SetBorder(true).
+		SetTitle(" snippets ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorderColor(t.Status).
+		SetTitleColor(t.Status).
+		SetBackgroundColor(t.Background)
+
+	ui.PickerInput = tview.NewInputField()
+	ui.PickerInput.
+		SetLabel("> ").
+		SetLabelColor(t.Status).
+		SetFieldTextColor(t.Foreground).
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetBackgroundColor(tcell.ColorDefault)
+
+	ui.PickerList = tview.NewList()
+	ui.PickerList.
+		ShowSecondaryText(false).
+		SetMainTextColor(t.Foreground).
+		SetSelectedTextColor(t.MatchFg).
+		SetSelectedBackgroundColor(t.MatchBg).
+		SetBackgroundColor(t.Background)
+
+	ui.picker = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(ui.PickerList, 0, 1, false).
+		AddItem(ui.PickerInput, 1, 0, true)
+	ui.picker.
+		SetBorder(true).
+		SetTitle(" history ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorderColor(t.Status).
+		SetTitleColor(t.Status).
+		SetBackgroundColor(t.Background)
+
+	ui.HelpView = tview.NewTextView()
+	ui.HelpView.
+		SetTextColor(t.Foreground).
+		SetBorder(true).
+		SetTitle(" keys ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorderColor(t.Status).
+		SetTitleColor(t.Status).
+		SetBackgroundColor(t.Background)
+
+	ui.ExplainView = tview.NewTextView()
+	ui.ExplainView.
+		SetTextColor(t.Foreground).
+		SetBorder(true).
+		SetTitle(" command ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorderColor(t.Status).
+		SetTitleColor(t.Status).
+		SetBackgroundColor(t.Background)
+
+	ui.QuitView = tview.NewTextView()
+	ui.QuitView.
+		SetText("Quit? y/N").
+		SetTextAlign(tview.AlignCenter).
+		SetTextColor(t.Foreground).
+		SetBorder(true).
+		SetBorderColor(t.Status).
+		SetBackgroundColor(t.Background)
+
+	ui.footer = tview.NewFlex()
+	ui.body = tview.NewFlex()
+	ui.body.SetBackgroundColor(t.Background)
+	ui.SetWrapWidth(0)
+	ui.panes = tview.NewFlex().
+		AddItem(ui.FrozenView, 0, 1, false).
+		AddItem(ui.body, 0, 1, false)
+	ui.layout = tview.NewFlex().SetDirection(tview.FlexRow)
+	ui.relayout()
+
+	ui.pages = tview.NewPages().AddPage("main", ui.layout, true, true)
+	ui.SetRoot(ui.pages, true)
+	ui.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		if width, _ := screen.Size(); width != ui.width {
+			ui.width = width
+			ui.fitFooter()
+		}
+		return false
+	})
+	return ui
+}
+
+// SetScreen sets the screen Run draws on instead of the terminal.
+func (ui *tui) SetScreen(screen tcell.Screen) {
+	ui.screen = screen
+}
+
+// EnableMouse sets whether Run enables the mouse.
+func (ui *tui) EnableMouse(enable bool) {
+	ui.mouse = enable
+}
+
+// SetColorMode sets the colors Run draws with, one of ColorModes, or leaves
+// them to the terminal when mode is empty.
+func (ui *tui) SetColorMode(mode string) {
+	ui.colors = mode
+}
+
+// newScreen creates the terminal screen, telling tcell to use true color when
+// it is forced. tcell reads COLORTERM only here, so it is restored afterwards
+// to keep it from the commands run.
+func (ui *tui) newScreen() (tcell.Screen, error) {
+	if ui.colors != "truecolor" {
+		return tcell.NewScreen()
+	}
+
+	old, ok := os.LookupEnv("COLORTERM")
+	os.Setenv("COLORTERM", "truecolor")
+	defer func() {
+		if ok {
+			os.Setenv("COLORTERM", old)
+		} else {
+			os.Unsetenv("COLORTERM")
+		}
+	}()
+	return tcell.NewScreen()
+}
+
+// Run starts the application with bracketed paste enabled.
+func (ui *tui) Run() error {
+	screen := ui.screen
+	if screen == nil {
+		var err error
+		if screen, err = ui.newScreen(); err != nil {
+			return err
+		}
+		if err := screen.Init(); err != nil {
+			return err
+		}
+	}
+	screen.EnablePaste()
+	if ui.mouse {
+		screen.EnableMouse()
+	}
+
+	switch ui.colors {
+	case "256":
+		screen = newColorScreen(screen, 256)
+	case "16":
+		screen = newColorScreen(screen, 16)
+	case "mono":
+		screen = newColorScreen(screen, 0)
+	}
+	ui.Application.SetScreen(&pasteScreen{Screen: screen})
+	return ui.Application.Run()
+}
+
+func (ui *tui) ShowModal(name string, p tview.Primitive, width, height int) {
+	modal := tview.NewGrid().
+		SetColumns(0, width, 0).
+		SetRows(0, height, 0).
+		AddItem(p, 1, 1, 1, 1, 0, 0, true)
+
+	ui.focus = ui.GetFocus()
+	ui.pages.AddPage(name, modal, true, true)
+	ui.SetFocus(p)
+}
+
+func (ui *tui) HideModal(name string) {
+	ui.pages.RemovePage(name)
+	ui.SetFocus(ui.focus)
+}
+
+// ShowPicker shows the fuzzy picker over the whole screen.
+func (ui *tui) ShowPicker() {
+	ui.focus = ui.GetFocus()
+	ui.pages.AddPage("picker", ui.picker, true, true)
+	ui.SetFocus(ui.PickerInput)
+}
+
+func (ui *tui) HidePicker() {
+	ui.HideModal("picker")
+}
+
+func (ui *tui) ModalVisible() bool {
+	return ui.pages.GetPageCount() > 1
+}
+
+func (ui *tui) ShowHelp(text string) {
+	ui.HelpView.SetText(text).ScrollToBeginning()
+	ui.ShowModal("help", ui.HelpView, 72, 26)
+}
+
+func (ui *tui) HideHelp() {
+	ui.HideModal("help")
+}
+
+func (ui *tui) HelpVisible() bool {
+	return ui.pages.HasPage("help")
+}
+
+func (ui *tui) ShowExplain(text string) {
+	ui.ExplainView.SetText(text).ScrollToBeginning()
+	ui.ShowModal("explain", ui.ExplainView, 72, 10)
+}
+
+func (ui *tui) HideExplain() {
+	ui.HideModal("explain")
+}
+
+func (ui *tui) ExplainVisible() bool {
+	return ui.pages.HasPage("explain")
+}
+
+func (ui *tui) ShowQuit() {
+	ui.ShowModal("quit", ui.QuitView, 20, 3)
+}
+
+func (ui *tui) HideQuit() {
+	ui.HideModal("quit")
+}
+
+func (ui *tui) QuitVisible() bool {
+	return ui.pages.HasPage("quit")
+}
+
+func (ui *tui) SetSplit(split bool) {
+	ui.split = split
+	ui.relayout()
+}
+
+// Freeze shows text, marked up like the output view's, in a pane beside the
+// output titled with the command that wrote it.
+func (ui *tui) Freeze(command, text string) {
+	ui.FrozenView.SetTitle(" frozen: " + tview.Escape(command) + " ")
+	ui.FrozenView.SetText(text).ScrollToBeginning()
+	ui.frozen = true
+	ui.relayout()
+}
+
+func (ui *tui) Unfreeze() {
+	ui.FrozenView.Clear()
+	ui.frozen = false
+	ui.relayout()
+}
+
+func (ui *tui) Frozen() bool {
+	return ui.frozen
+}
+
+// SetWrapWidth narrows the output view to width columns, or lets it fill the
+// screen when width is 0.
+func (ui *tui) SetWrapWidth(width int) {
+	ui.body.Clear()
+	if width > 0 {
+		ui.body.AddItem(ui.MainView, width, 0, false).AddItem(nil, 0, 1, false)
+	} else {
+		ui.body.AddItem(ui.MainView, 0, 1, false)
+	}
+}
+
+func (ui *tui) SetMultiline(multiline bool) {
+	ui.multiline = multiline
+	ui.relayout()
+}
+
+func (ui *tui) Editor() tview.Primitive {
+	if ui.multiline {
+		return ui.CmdArea
+	}
+	return ui.CmdInput
+}
+
+func (ui *tui) InEditor(x, y int) bool {
+	if ui.multiline {
+		return ui.CmdArea.InRect(x, y)
+	}
+	return ui.CmdInput.InRect(x, y)
+}
+
+func (ui *tui) relayout() {
+	height := 1
+	if ui.multiline {
+		height = cmdAreaHeight
+	}
+
+	ui.footer.Clear()
+	ui.footer.
+		AddItem(ui.Editor(), 0, 1, true).
+		AddItem(ui.ModeView, 0, 0, false).
+		AddItem(ui.TimeView, 0, 0, false).
+		AddItem(ui.ExitView, 0, 0, false).
+		AddItem(ui.SizeView, 0, 0, false)
+	ui.fitFooter()
+
+	var prompts []tview.Primitive
+	for i := 0; i < ui.layout.GetItemCount(); i++ {
+		switch p := ui.layout.GetItem(i); p {
+		case ui.FindInput, ui.FilterInput, ui.StdinInput, ui.NameInput, ui.SearchInput:
+			prompts = append(prompts, p)
+		}
+	}
+
+	ui.layout.Clear()
+	if ui.TruncView.GetText(false) != "" {
+		ui.layout.AddItem(ui.TruncView, 1, 0, false)
+	}
+	if ui.frozen {
+		ui.layout.AddItem(ui.panes, 0, 2, false)
+	} else {
+		ui.layout.AddItem(ui.body, 0, 2, false)
+	}
+	if ui.split {
+		ui.layout.AddItem(ui.ErrView, 0, 1, false)
+	}
+	ui.layout.AddItem(ui.footer, height, 0, true)
+	for _, p := range prompts {
+		ui.layout.AddItem(p, 1, 0, true)
+	}
+}
+
+// SetTruncated shows a banner above the output saying what was dropped from
+// it, or hides the banner when text is empty.
+func (ui *tui) SetTruncated(text string) {
+	shown := ui.TruncView.GetText(false) != ""
+	ui.TruncView.SetText(text)
+	if shown != (text != "") {
+		ui.relayout()
+	}
+}
+
+// SetSizeText shows the size of the output and widens its field when the text
+// no longer fits.
+func (ui *tui) SetSizeText(text string, color tcell.Color) {
+	ui.SizeView.SetText(text).SetTextColor(color)
+	if width := len(text) + 1; width != ui.sizeWidth {
+		ui.sizeWidth = width
+		ui.fitFooter()
+	}
+}
+
+// fitFooter sizes the footer fields to the screen, dropping the time, the
+// mode and then the size while the editor would be narrower than
+// minEditorWidth.
+func (ui *tui) fitFooter() {
+	size := sizeViewWidth
+	if ui.sizeWidth > size {
+		size = ui.sizeWidth
+	}
+
+	fields := []struct {
+		p     tview.Primitive
+		width int
+	}{
+		{ui.TimeView, 8},
+		{ui.ModeView, 14},
+		{ui.SizeView, size},
+		{ui.ExitView, 11},
+	}
+	total := 0
+	for _, f := range fields {
+		total += f.width
+	}
+	for i := range fields[:3] {
+		if ui.width == 0 || ui.width-total >= minEditorWidth {
+			break
+		}
+		total -= fields[i].width
+		fields[i].width = 0
+	}
+
+	for _, f := range fields {
+		ui.footer.ResizeItem(f.p, f.width, 0)
+	}
+}
+
+// GetTypedText returns the command as typed, without the fallback.
+func (ui *tui) GetTypedText() string {
+	text := ui.CmdInput.GetText()
+	if ui.multiline {
+		text = ui.CmdArea.GetText()
+	}
+	return strings.TrimSpace(text)
+}
+
+func (ui *tui) GetInputText() string {
+	if text := ui.GetTypedText(); text != "" {
+		return text
+	}
+	return ui.fallback
+}